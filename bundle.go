@@ -0,0 +1,91 @@
+package donegroup
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+)
+
+// Bundle is a reusable set of cleanup functions that is registered into a doneGroup later by RegisterBundle.
+// It lets a library hand back the teardown of the resources it sets up, instead of forcing its own context on the callers.
+// The zero value is an empty Bundle ready to use. It is safe for concurrent use.
+type Bundle struct {
+	cleanups []bundleCleanup
+	mu       sync.Mutex
+}
+
+type bundleCleanup struct {
+	f    func(ctx context.Context) error
+	opts []CleanupOption
+}
+
+// Add adds a function to the Bundle. The options are applied when the Bundle is registered.
+// It panics with ErrNilFunc if f is nil.
+func (b *Bundle) Add(f func() error, opts ...CleanupOption) {
+	if f == nil {
+		panic(ErrNilFunc)
+	}
+	b.AddWithContext(func(_ context.Context) error {
+		return f()
+	}, opts...)
+}
+
+// AddWithContext adds a function receiving the context like CleanupWithContext to the Bundle. The options are applied when the Bundle is registered.
+// It panics with ErrNilFunc if f is nil.
+func (b *Bundle) AddWithContext(f func(ctx context.Context) error, opts ...CleanupOption) {
+	if f == nil {
+		panic(ErrNilFunc)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cleanups = append(b.cleanups, bundleCleanup{f: f, opts: opts})
+}
+
+// Merge adds the functions of the other Bundles to the Bundle, in order. The other Bundles are not changed.
+func (b *Bundle) Merge(others ...*Bundle) {
+	for _, o := range others {
+		if o == nil || o == b {
+			continue
+		}
+		o.mu.Lock()
+		cs := slices.Clone(o.cleanups)
+		o.mu.Unlock()
+		b.mu.Lock()
+		b.cleanups = append(b.cleanups, cs...)
+		b.mu.Unlock()
+	}
+}
+
+// Len returns the number of the functions of the Bundle.
+func (b *Bundle) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.cleanups)
+}
+
+// RegisterBundle registers all the functions of the Bundle to be called when the context is canceled, in the order they were added.
+// The Bundle is not changed, so it can be registered into several contexts.
+// The errors of the registrations (e.g. ErrLateRegistration) are joined.
+func RegisterBundle(ctx context.Context, b *Bundle) error {
+	return RegisterBundleWithKey(ctx, doneGroupKey, b)
+}
+
+// RegisterBundleWithKey registers all the functions of the Bundle to be called when the context is canceled, in the order they were added.
+// The Bundle is not changed, so it can be registered into several contexts.
+// The errors of the registrations (e.g. ErrLateRegistration) are joined.
+func RegisterBundleWithKey(ctx context.Context, key any, b *Bundle) error {
+	if _, ok := ctx.Value(key).(*doneGroup); !ok {
+		return ErrNotContainDoneGroup
+	}
+	b.mu.Lock()
+	cs := slices.Clone(b.cleanups)
+	b.mu.Unlock()
+	var errs error
+	for _, c := range cs {
+		if err := CleanupWithContextAndKey(ctx, key, c.f, c.opts...); err != nil {
+			errs = errors.Join(errs, err)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,65 @@
+package donegroup
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestBundle(t *testing.T) {
+	t.Parallel()
+	var (
+		mu     sync.Mutex
+		called []string
+	)
+	record := func(name string) func() error {
+		return func() error {
+			mu.Lock()
+			defer mu.Unlock()
+			called = append(called, name)
+			return nil
+		}
+	}
+	db := &Bundle{}
+	db.Add(record("db"))
+	cache := &Bundle{}
+	cache.Add(record("cache"))
+	cache.AddWithContext(func(ctx context.Context) error {
+		return record("cache-ctx")()
+	})
+	b := &Bundle{}
+	b.Merge(db, cache, nil)
+	if got := b.Len(); got != 3 {
+		t.Errorf("got %d, want %d", got, 3)
+	}
+
+	ctx, cancel := WithCancel(context.Background(), WithMaxConcurrentCleanups(1))
+	if err := RegisterBundle(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	// The Bundle can be registered again
+	other, cancelOther := WithCancel(context.Background())
+	if err := RegisterBundle(other, db); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := Wait(ctx); err != nil {
+		t.Error(err)
+	}
+	if want := []string{"db", "cache", "cache-ctx"}; !slices.Equal(called, want) {
+		t.Errorf("got %v, want %v", called, want)
+	}
+	cancelOther()
+	if err := Wait(other); err != nil {
+		t.Error(err)
+	}
+	if got := len(called); got != 4 {
+		t.Errorf("got %d, want %d", got, 4)
+	}
+
+	if err := RegisterBundle(context.Background(), b); !errors.Is(err, ErrNotContainDoneGroup) {
+		t.Errorf("got %v, want %v", err, ErrNotContainDoneGroup)
+	}
+}
@@ -0,0 +1,149 @@
+package donegroup
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Checkpoint calls the cleanup functions registered so far as if the context were canceled, and waits for them with timeout.
+// The context is not canceled, so it can be used continuously with a fresh set of cleanup functions (e.g. a periodic flush point of a long-running worker).
+// It returns the errors of the cleanup functions of the snapshot, which are not collected into the doneGroup.
+// The cleanup functions registered during the checkpoint belong to the fresh set and are not called by it.
+// The phases (CleanupInPhase) and WithMaxConcurrentCleanups apply within the snapshot. The cleanup functions of the descendant doneGroups are not called.
+// If the timeout has passed, it returns ErrWaitTimeout. The cleanup functions of the later phases of the snapshot are returned to the fresh set,
+// and the errors of the started ones are collected into the doneGroup when they finish.
+// If the context is already canceled, it returns ErrAlreadyCanceled.
+func Checkpoint(ctx context.Context, timeout time.Duration) error {
+	return CheckpointWithKey(ctx, timeout, doneGroupKey)
+}
+
+// CheckpointWithKey calls the cleanup functions registered so far as if the context were canceled, and waits for them with timeout.
+// The context is not canceled, so it can be used continuously with a fresh set of cleanup functions (e.g. a periodic flush point of a long-running worker).
+// It returns the errors of the cleanup functions of the snapshot, which are not collected into the doneGroup.
+// The cleanup functions registered during the checkpoint belong to the fresh set and are not called by it.
+// The phases (CleanupInPhaseWithKey) and WithMaxConcurrentCleanups apply within the snapshot. The cleanup functions of the descendant doneGroups are not called.
+// If the timeout has passed, it returns ErrWaitTimeout. The cleanup functions of the later phases of the snapshot are returned to the fresh set,
+// and the errors of the started ones are collected into the doneGroup when they finish.
+// If the context is already canceled, it returns ErrAlreadyCanceled.
+func CheckpointWithKey(ctx context.Context, timeout time.Duration, key any) error {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return ErrNotContainDoneGroup
+	}
+	dg.mu.Lock()
+	if dg.draining || ctx.Err() != nil {
+		dg.mu.Unlock()
+		return ErrAlreadyCanceled
+	}
+	snapshot := dg.cleanups
+	dg.cleanups = nil
+	dg.mu.Unlock()
+	slices.SortStableFunc(snapshot, func(a, b *cleanup) int {
+		return cmp.Compare(a.phase, b.phase)
+	})
+
+	deadline := time.Now().Add(timeout)
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	var (
+		mu       sync.Mutex
+		errs     []error
+		timedOut bool
+	)
+	limit := len(snapshot)
+	if n := dg.config.maxConcurrentCleanups; n > 0 {
+		limit = n
+	}
+	sem := make(chan struct{}, max(limit, 1))
+	for len(snapshot) > 0 {
+		n := 1
+		for n < len(snapshot) && snapshot[n].phase == snapshot[0].phase {
+			n++
+		}
+		phase := snapshot[:n]
+		snapshot = snapshot[n:]
+		wg := &sync.WaitGroup{}
+		for _, c := range phase {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				dg.checkpointRun(c, deadline, func(err error) {
+					mu.Lock()
+					defer mu.Unlock()
+					if timedOut {
+						dg.appendCleanupError(err)
+						return
+					}
+					errs = append(errs, err)
+				})
+			}()
+		}
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-t.C:
+			mu.Lock()
+			timedOut = true
+			errs = append(errs, fmt.Errorf("%w: %w", ErrWaitTimeout, context.DeadlineExceeded))
+			err := errors.Join(errs...)
+			mu.Unlock()
+			dg.requeue(snapshot)
+			return err
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return errors.Join(errs...)
+}
+
+// checkpointRun executes the cleanup function of the snapshot of Checkpoint, and passes the error to report before it is marked as finished.
+func (dg *doneGroup) checkpointRun(c *cleanup, deadline time.Time, report func(error)) {
+	rootWg := dg.cleanupGroups[0]
+	dg.mu.Lock()
+	if dg.executing == nil {
+		dg.executing = make(map[*cleanup]struct{})
+	}
+	dg.executing[c] = struct{}{}
+	dg.mu.Unlock()
+	start := time.Now()
+	err := dg.call(c, deadline)
+	elapsed := time.Since(start)
+	if err != nil {
+		report(err)
+	}
+	c.finish(err)
+	dg.mu.Lock()
+	delete(dg.executing, c)
+	dg.pending--
+	dg.executed++
+	if c.tag != "" {
+		dg.tags[c.tag].Pending--
+		dg.tags[c.tag].Duration += elapsed
+	}
+	dg.mu.Unlock()
+	rootWg.Done()
+}
+
+// requeue returns the cleanup functions that have not started to the front of the pending cleanup functions.
+func (dg *doneGroup) requeue(cs []*cleanup) {
+	if len(cs) == 0 {
+		return
+	}
+	dg.mu.Lock()
+	defer dg.mu.Unlock()
+	dg.cleanups = slices.Concat(cs, dg.cleanups)
+	if dg.draining {
+		dg.runLocked()
+	}
+}
@@ -0,0 +1,81 @@
+package donegroup
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheckpoint(t *testing.T) {
+	t.Parallel()
+	errFlush := errors.New("flush failed")
+	errClose := errors.New("close failed")
+	ctx, cancel := WithCancel(context.Background())
+	var flushed atomic.Int64
+	if err := Cleanup(ctx, func() error {
+		flushed.Add(1)
+		return errFlush
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Checkpoint(ctx, time.Second); !errors.Is(err, errFlush) {
+		t.Errorf("got %v, want %v", err, errFlush)
+	}
+	if ctx.Err() != nil {
+		t.Error("context should be live after the checkpoint")
+	}
+	if err := Checkpoint(ctx, time.Second); err != nil {
+		t.Errorf("got %v, want nil for the empty set", err)
+	}
+	if err := Cleanup(ctx, func() error {
+		return errClose
+	}); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	err := Wait(ctx)
+	if !errors.Is(err, errClose) || errors.Is(err, errFlush) {
+		t.Errorf("got %v, want only the error of the fresh set", err)
+	}
+	if got := flushed.Load(); got != 1 {
+		t.Errorf("got %d calls, want 1", got)
+	}
+	if err := Checkpoint(ctx, time.Second); !errors.Is(err, ErrAlreadyCanceled) {
+		t.Errorf("got %v, want %v", err, ErrAlreadyCanceled)
+	}
+}
+
+func TestCheckpointTimeout(t *testing.T) {
+	t.Parallel()
+	errSlow := errors.New("slow failed")
+	ctx, cancel := WithCancel(context.Background())
+	if err := Cleanup(ctx, func() error {
+		time.Sleep(50 * time.Millisecond)
+		return errSlow
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var last atomic.Bool
+	if err := CleanupInPhase(ctx, PhaseLast, func() error {
+		last.Store(true)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Checkpoint(ctx, 10*time.Millisecond); !errors.Is(err, ErrWaitTimeout) {
+		t.Errorf("got %v, want %v", err, ErrWaitTimeout)
+	}
+	if last.Load() {
+		t.Error("the cleanup function of the later phase should not be called by the timed-out checkpoint")
+	}
+	cancel()
+	// The later phase is returned to the fresh set, and the late error is collected into the doneGroup
+	if err := Wait(ctx); !errors.Is(err, errSlow) {
+		t.Errorf("got %v, want %v", err, errSlow)
+	}
+	if !last.Load() {
+		t.Error("the returned cleanup function should be called on shutdown")
+	}
+}
@@ -0,0 +1,59 @@
+package donegroup
+
+import (
+	"context"
+	"errors"
+)
+
+// Defer pushes a function onto the defer stack of the doneGroup, like the defer statement.
+// When the context is canceled, the functions of the stack are called sequentially in strict LIFO order (the last pushed is called first), as one cleanup function.
+// So the stack is bounded by the timeout of WaitWithTimeout shared with the other cleanup functions, which run concurrently with the stack.
+// All the functions are called even if some of them return errors, and the errors are joined in the order of the calls and returned by Wait.
+// A function pushed by a running function of the stack is called next, like a defer in a deferred function.
+func Defer(ctx context.Context, f func() error) error {
+	return DeferWithKey(ctx, doneGroupKey, f)
+}
+
+// DeferWithKey pushes a function onto the defer stack of the doneGroup, like the defer statement.
+// When the context is canceled, the functions of the stack are called sequentially in strict LIFO order (the last pushed is called first), as one cleanup function.
+// So the stack is bounded by the timeout of WaitWithTimeoutAndKey shared with the other cleanup functions, which run concurrently with the stack.
+// All the functions are called even if some of them return errors, and the errors are joined in the order of the calls and returned by WaitWithKey.
+// A function pushed by a running function of the stack is called next, like a defer in a deferred function.
+func DeferWithKey(ctx context.Context, key any, f func() error) error {
+	if f == nil {
+		return ErrNilFunc
+	}
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return ErrNotContainDoneGroup
+	}
+	dg.mu.Lock()
+	dg.deferred = append(dg.deferred, f)
+	if dg.deferring {
+		// The stack is already registered (or running)
+		dg.mu.Unlock()
+		return nil
+	}
+	dg.deferring = true
+	dg.mu.Unlock()
+	return CleanupWithKey(ctx, key, dg.runDeferred)
+}
+
+// runDeferred pops the functions of the defer stack and calls them until the stack is empty.
+func (dg *doneGroup) runDeferred() error {
+	var errs []error
+	for {
+		dg.mu.Lock()
+		if len(dg.deferred) == 0 {
+			dg.deferring = false
+			dg.mu.Unlock()
+			return errors.Join(errs...)
+		}
+		f := dg.deferred[len(dg.deferred)-1]
+		dg.deferred = dg.deferred[:len(dg.deferred)-1]
+		dg.mu.Unlock()
+		if err := f(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+}
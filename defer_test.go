@@ -0,0 +1,57 @@
+package donegroup
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestDefer(t *testing.T) {
+	t.Parallel()
+	var want []int
+	func() {
+		for i := range 3 {
+			defer func() {
+				want = append(want, i)
+				if i == 1 {
+					defer func() {
+						want = append(want, 10)
+					}()
+				}
+			}()
+		}
+	}()
+
+	errTest := errors.New("test error")
+	ctx, cancel := WithCancel(context.Background())
+	var got []int
+	for i := range 3 {
+		if err := Defer(ctx, func() error {
+			got = append(got, i)
+			if i == 1 {
+				if err := Defer(ctx, func() error {
+					got = append(got, 10)
+					return nil
+				}); err != nil {
+					return err
+				}
+				return errTest
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cancel()
+	if err := Wait(ctx); !errors.Is(err, errTest) {
+		t.Errorf("got %v, want %v", err, errTest)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if err := Defer(context.Background(), func() error { return nil }); !errors.Is(err, ErrNotContainDoneGroup) {
+		t.Errorf("got %v, want %v", err, ErrNotContainDoneGroup)
+	}
+}
@@ -3,51 +3,225 @@ package donegroup
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"log"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var doneGroupKey = struct{}{}
+
+// doneGroupKeysKey is the key of the keys of the doneGroups installed on the context.
+type doneGroupKeysKey struct{}
+
+// cleanupCtxKey is the key of the doneGroup whose cleanup function receives the context.
+type cleanupCtxKey struct{}
+
+// goTaskKey is the key of the function to mark the process receiving the context as completed.
+type goTaskKey struct{}
+
 var ErrNotContainDoneGroup = errors.New("donegroup: context does not contain a doneGroup. Use donegroup.With* to create a context with a doneGroup")
+var ErrNotCancelable = errors.New("donegroup: doneGroup does not have its own cancel func. Cancel the parent context instead")
+var ErrCleanupRegistered = errors.New("donegroup: cleanup functions have been registered")
+var ErrAlreadyCanceled = errors.New("donegroup: context is already canceled")
+var ErrCleanupEscalated = errors.New("donegroup: cleanup escalated to forceful teardown")
+var ErrNilFunc = errors.New("donegroup: function is nil")
+var ErrWaitInCleanup = errors.New("donegroup: waiting for the doneGroup from its own cleanup function would deadlock")
+var ErrCleanupNotFound = errors.New("donegroup: cleanup function with the name is not registered")
+var ErrNoPreCancelBarrier = errors.New("donegroup: pre-cancel barrier is not enabled. Use donegroup.WithPreCancelBarrier")
+
+// ErrLateRegistration is returned by Cleanup when WithLateRegistrationCheck is enabled and the cleanup function is registered too late to be waited for by Wait.
+// The cleanup function is still registered and called, but its error may never be returned by Wait.
+var ErrLateRegistration = errors.New("donegroup: cleanup function registered after Wait finished waiting")
+
+// ErrMaxDepthExceeded is returned by Cleanup when WithStrictMaxDepth is enabled and the doneGroup is nested deeper than the max depth.
+// It usually means WithCancel is applied to the same context repeatedly by mistake (e.g. in a middleware applied twice). The cleanup function is still registered and called.
+var ErrMaxDepthExceeded = errors.New("donegroup: doneGroup is nested deeper than the max depth")
+
+// depthReport reports the doneGroup nested deeper than the max depth of WithMaxDepth. It is replaced in tests.
+var depthReport = func(msg string) {
+	log.Print(msg)
+}
+
+// ErrWaitTimeout is joined to the error of Wait when waiting gives up because the timeout of WaitWithTimeout has passed (or the context of WaitWithContext has been canceled).
+// The error also wraps the error of the waiting context, so errors.Is(err, context.DeadlineExceeded) still reports true for a timeout.
+var ErrWaitTimeout = errors.New("donegroup: waiting for cleanup functions gave up")
+
+// ErrQuorumNotReached is returned by WaitQuorum when all the cleanup functions finish without reaching the quorum.
+var ErrQuorumNotReached = errors.New("donegroup: quorum of successful cleanup functions not reached")
+
+// ErrRequiredGoUnfinished is joined to the error of Wait when the processes started by GoRequired are still running at the hard limit of WithRequiredGoLimit.
+var ErrRequiredGoUnfinished = errors.New("donegroup: required processes still running at the hard limit")
 
 // doneGroup is cleanup function groups per Context.
 type doneGroup struct {
-	cancel        context.CancelCauseFunc
-	cleanupGroups []*sync.WaitGroup
-	errors        error
-	mu            sync.Mutex
+	cancel          context.CancelCauseFunc
+	cleanupGroups   []*cleanupGroup
+	cleanups        []*cleanup
+	inflight        map[*cleanup]struct{}
+	executing       map[*cleanup]struct{}
+	ctx             context.Context
+	parentCtx       context.Context
+	settled         chan struct{}
+	cleanupCtx      context.Context
+	cleanupBase     context.Context
+	cancelCleanup   context.CancelCauseFunc
+	parent          *doneGroup
+	children        []*doneGroup
+	depth           int
+	draining        bool
+	canceledAt      time.Time
+	waitDeadline    time.Time
+	running         int
+	waitReturned    bool
+	abandoned       bool
+	executed        int
+	failures        []cleanupFailure
+	finishedAt      time.Time
+	named           map[string][]*cleanup
+	phased          bool
+	runningPhases   map[Phase]int
+	tasks           int
+	registered      int
+	registeredAt    []time.Time
+	pending         int
+	unused          bool
+	cancelCalled    bool
+	canceledOwn     atomic.Bool
+	ownDeadline     time.Time
+	cancellerStack  []byte
+	waiting         int
+	errors          []error
+	ownErrors       error
+	collected       int
+	elided          *elidedError
+	firstErr        error
+	firstCleanupErr error
+	goInflight      int
+	goFinished      int
+	requiredGo      int
+	requiredIdle    chan struct{}
+	goWatchers      []chan struct{}
+	deferred        []func() error
+	deferring       bool
+	succeeded       int
+	quorumWatchers  []chan struct{}
+	goRoundErrors   []error
+	preCancel       []func() error
+	preCancelOnce   sync.Once
+	preCancelDone   bool
+	firstErrChs     []chan error
+	tokens          map[any]struct{}
+	leak            *leakTracker
+	tags            map[string]*TagStats
+	store           *ShutdownStore
+	config          *config
+	mu              sync.Mutex
+}
+
+// cleanup is a registered cleanup function or a process guarded by Awaiter (or Go).
+type cleanup struct {
+	f                 func(ctx context.Context) error
+	name              string
+	tag               string
+	stack             string
+	ignoreWaitTimeout bool
+	phase             Phase
+	timeout           time.Duration
+	// done is closed when the named cleanup function finishes, and err is its error
+	done chan struct{}
+	err  error
+}
+
+// cleanupFailure is the error of a cleanup function with its name.
+type cleanupFailure struct {
+	name string
+	err  error
+}
+
+// cleanupGroup is a sync.WaitGroup that can report whether its counter is zero.
+type cleanupGroup struct {
+	sync.WaitGroup
+	n atomic.Int64
+}
+
+func (g *cleanupGroup) Add(delta int) {
+	g.n.Add(int64(delta))
+	g.WaitGroup.Add(delta)
+}
+
+func (g *cleanupGroup) Done() {
+	g.Add(-1)
+}
+
+// elidedError reports the number of the errors not collected due to WithMaxCollectedErrors.
+type elidedError struct {
+	n atomic.Int64
+}
+
+func (e *elidedError) Error() string {
+	return fmt.Sprintf("donegroup: %d errors elided", e.n.Load())
 }
 
 // WithCancel returns a copy of parent with a new Done channel and a doneGroup.
-func WithCancel(ctx context.Context) (context.Context, context.CancelFunc) {
-	return WithCancelWithKey(ctx, doneGroupKey)
+func WithCancel(ctx context.Context, opts ...Option) (context.Context, context.CancelFunc) {
+	return WithCancelWithKey(ctx, doneGroupKey, opts...)
 }
 
 // WithDeadline returns a copy of parent with a new Done channel and a doneGroup.
 // If the deadline is exceeded, the cause is set to context.DeadlineExceeded.
-func WithDeadline(ctx context.Context, d time.Time) (context.Context, context.CancelFunc) {
-	return WithDeadlineCause(ctx, d, nil)
+// If the deadline has already passed, the context is immediately done and each cleanup function starts executing as soon as it is registered.
+func WithDeadline(ctx context.Context, d time.Time, opts ...Option) (context.Context, context.CancelFunc) {
+	return WithDeadlineCause(ctx, d, nil, opts...)
 }
 
 // WithTimeout returns a copy of parent with a new Done channel and a doneGroup.
 // If the timeout is exceeded, the cause is set to context.DeadlineExceeded.
-func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
-	return WithTimeoutCause(ctx, timeout, nil)
+func WithTimeout(ctx context.Context, timeout time.Duration, opts ...Option) (context.Context, context.CancelFunc) {
+	return WithTimeoutCause(ctx, timeout, nil, opts...)
 }
 
 // WithCancelCause returns a copy of parent with a new Done channel and a doneGroup.
-func WithCancelCause(ctx context.Context) (context.Context, context.CancelCauseFunc) {
-	return WithCancelCauseWithKey(ctx, doneGroupKey)
+func WithCancelCause(ctx context.Context, opts ...Option) (context.Context, context.CancelCauseFunc) {
+	return WithCancelCauseWithKey(ctx, doneGroupKey, opts...)
 }
 
 // WithDeadlineCause returns a copy of parent with a new Done channel and a doneGroup.
-func WithDeadlineCause(ctx context.Context, d time.Time, cause error) (context.Context, context.CancelFunc) {
-	return WithDeadlineCauseWithKey(ctx, d, cause, doneGroupKey)
+func WithDeadlineCause(ctx context.Context, d time.Time, cause error, opts ...Option) (context.Context, context.CancelFunc) {
+	return WithDeadlineCauseWithKey(ctx, d, cause, doneGroupKey, opts...)
 }
 
 // WithTimeoutCause returns a copy of parent with a new Done channel and a doneGroup.
-func WithTimeoutCause(ctx context.Context, timeout time.Duration, cause error) (context.Context, context.CancelFunc) {
-	return WithTimeoutCauseWithKey(ctx, timeout, cause, doneGroupKey)
+func WithTimeoutCause(ctx context.Context, timeout time.Duration, cause error, opts ...Option) (context.Context, context.CancelFunc) {
+	return WithTimeoutCauseWithKey(ctx, timeout, cause, doneGroupKey, opts...)
+}
+
+// WithInheritedCancel returns a copy of parent with a doneGroup that does not have its own cancel func.
+// The doneGroup is canceled only when parent is canceled. Cancel for the returned context returns ErrNotCancelable.
+func WithInheritedCancel(ctx context.Context, opts ...Option) context.Context {
+	return WithInheritedCancelWithKey(ctx, doneGroupKey, opts...)
+}
+
+// WithCancelWait returns a copy of parent with a new Done channel and a doneGroup, and a function that cancels the context and waits for the cleanup functions like Wait.
+// The function returns the aggregated error of Wait. It is intended to be deferred in a single call.
+func WithCancelWait(ctx context.Context, opts ...Option) (context.Context, func() error) {
+	return WithCancelWaitWithKey(ctx, doneGroupKey, opts...)
+}
+
+// WithCancelWaitTimeout returns a copy of parent with a new Done channel and a doneGroup, and a function that cancels the context and waits for the cleanup functions with timeout like WaitWithTimeout.
+// The function returns the aggregated error of WaitWithTimeout. It is intended to be deferred in a single call.
+func WithCancelWaitTimeout(ctx context.Context, timeout time.Duration, opts ...Option) (context.Context, func() error) {
+	return WithCancelWaitTimeoutWithKey(ctx, timeout, doneGroupKey, opts...)
+}
+
+// WithCancelAny returns a context with a new Done channel and a doneGroup, which is canceled when any of the parents is done (or its cancel func is called).
+// The cause is set to the cause of the parent that is done first. If several parents are done at almost the same time, the first one observed wins.
+// The values (and the parent doneGroup) are inherited from the first parent.
+func WithCancelAny(parents ...context.Context) (context.Context, context.CancelFunc) {
+	return WithCancelAnyWithKey(doneGroupKey, parents...)
 }
 
 // WithoutCancel returns a copy of parent that is not canceled when parent is canceled and does not have a doneGroup.
@@ -60,74 +234,494 @@ func WithoutCancelWithKey(ctx context.Context, key any) context.Context {
 	return context.WithValue(context.WithoutCancel(ctx), key, nil)
 }
 
+// WithInheritedCancelWithKey returns a copy of parent with a doneGroup that does not have its own cancel func.
+// The doneGroup is canceled only when parent is canceled. CancelWithKey for the returned context returns ErrNotCancelable.
+func WithInheritedCancelWithKey(ctx context.Context, key any, opts ...Option) context.Context {
+	return withDoneGroup(ctx, ctx, nil, key, opts)
+}
+
+// WithCancelWaitWithKey returns a copy of parent with a new Done channel and a doneGroup, and a function that cancels the context and waits for the cleanup functions like WaitWithKey.
+// The function returns the aggregated error of WaitWithKey. It is intended to be deferred in a single call.
+func WithCancelWaitWithKey(ctx context.Context, key any, opts ...Option) (context.Context, func() error) {
+	ctx, cancel := WithCancelWithKey(ctx, key, opts...)
+	return ctx, func() error {
+		cancel()
+		return WaitWithKey(ctx, key)
+	}
+}
+
+// WithCancelWaitTimeoutWithKey returns a copy of parent with a new Done channel and a doneGroup, and a function that cancels the context and waits for the cleanup functions with timeout like WaitWithTimeoutAndKey.
+// The function returns the aggregated error of WaitWithTimeoutAndKey. It is intended to be deferred in a single call.
+func WithCancelWaitTimeoutWithKey(ctx context.Context, timeout time.Duration, key any, opts ...Option) (context.Context, func() error) {
+	ctx, cancel := WithCancelWithKey(ctx, key, opts...)
+	return ctx, func() error {
+		cancel()
+		return WaitWithTimeoutAndKey(ctx, timeout, key)
+	}
+}
+
+// WithCancelAnyWithKey returns a context with a new Done channel and a doneGroup, which is canceled when any of the parents is done (or its cancel func is called).
+// The cause is set to the cause of the parent that is done first. If several parents are done at almost the same time, the first one observed wins.
+// The values (and the parent doneGroup) are inherited from the first parent.
+func WithCancelAnyWithKey(key any, parents ...context.Context) (context.Context, context.CancelFunc) {
+	first := context.Background()
+	if len(parents) > 0 {
+		first = parents[0]
+	}
+	ctx, cancelCause := WithCancelCauseWithKey(first, key)
+	if len(parents) > 1 {
+		stops := make([]func() bool, 0, len(parents)-1)
+		for _, p := range parents[1:] {
+			stops = append(stops, context.AfterFunc(p, func() {
+				cancelCause(context.Cause(p))
+			}))
+		}
+		context.AfterFunc(ctx, func() {
+			for _, stop := range stops {
+				stop()
+			}
+		})
+	}
+	return ctx, func() { cancelCause(nil) }
+}
+
 // WithCancelWithKey returns a copy of parent with a new Done channel and a doneGroup.
-func WithCancelWithKey(ctx context.Context, key any) (context.Context, context.CancelFunc) {
-	ctx, cancelCause := WithCancelCauseWithKey(ctx, key)
+func WithCancelWithKey(ctx context.Context, key any, opts ...Option) (context.Context, context.CancelFunc) {
+	ctx, cancelCause := WithCancelCauseWithKey(ctx, key, opts...)
 	return ctx, func() { cancelCause(nil) }
 }
 
 // WithDeadlineWithKey returns a copy of parent with a new Done channel and a doneGroup.
-func WithDeadlineWithKey(ctx context.Context, d time.Time, key any) (context.Context, context.CancelFunc) {
-	return WithDeadlineCauseWithKey(ctx, d, nil, key)
+func WithDeadlineWithKey(ctx context.Context, d time.Time, key any, opts ...Option) (context.Context, context.CancelFunc) {
+	return WithDeadlineCauseWithKey(ctx, d, nil, key, opts...)
 }
 
 // WithTimeoutWithKey returns a copy of parent with a new Done channel and a doneGroup.
-func WithTimeoutWithKey(ctx context.Context, timeout time.Duration, key any) (context.Context, context.CancelFunc) {
-	return WithTimeoutCauseWithKey(ctx, timeout, nil, key)
+func WithTimeoutWithKey(ctx context.Context, timeout time.Duration, key any, opts ...Option) (context.Context, context.CancelFunc) {
+	return WithTimeoutCauseWithKey(ctx, timeout, nil, key, opts...)
 }
 
 // WithCancelCauseWithKey returns a copy of parent with a new Done channel and a doneGroup.
-func WithCancelCauseWithKey(ctx context.Context, key any) (context.Context, context.CancelCauseFunc) {
+func WithCancelCauseWithKey(ctx context.Context, key any, opts ...Option) (context.Context, context.CancelCauseFunc) {
+	parentCtx := ctx
 	ctx, cancelCause := context.WithCancelCause(ctx)
-	return withDoneGroup(ctx, cancelCause, key), cancelCause
+	ctx = withDoneGroup(parentCtx, ctx, cancelCause, key, opts)
+	// The cancel func may be wrapped by WithPreCancelBarrier
+	return ctx, ctx.Value(key).(*doneGroup).cancel
 }
 
 // WithDeadlineCauseWithKey returns a copy of parent with a new Done channel and a doneGroup.
-func WithDeadlineCauseWithKey(ctx context.Context, d time.Time, cause error, key any) (context.Context, context.CancelFunc) {
+func WithDeadlineCauseWithKey(ctx context.Context, d time.Time, cause error, key any, opts ...Option) (context.Context, context.CancelFunc) {
+	parentCtx := ctx
 	ctx, cancelCause := context.WithCancelCause(ctx)
 	ctx, cancel := context.WithDeadlineCause(ctx, d, cause)
-	ctx = withDoneGroup(ctx, cancelCause, key)
-	return ctx, cancel
+	ctx = withDoneGroup(parentCtx, ctx, cancelCause, key, opts)
+	dg := ctx.Value(key).(*doneGroup)
+	dg.ownDeadline = d
+	return ctx, func() {
+		// Go through the cancel func of the doneGroup so that WithPreCancelBarrier applies
+		dg.cancel(context.Canceled)
+		cancel()
+	}
 }
 
 // WithTimeoutCauseWithKey returns a copy of parent with a new Done channel and a doneGroup.
-func WithTimeoutCauseWithKey(ctx context.Context, timeout time.Duration, cause error, key any) (context.Context, context.CancelFunc) {
-	return WithDeadlineCauseWithKey(ctx, time.Now().Add(timeout), cause, key)
+func WithTimeoutCauseWithKey(ctx context.Context, timeout time.Duration, cause error, key any, opts ...Option) (context.Context, context.CancelFunc) {
+	return WithDeadlineCauseWithKey(ctx, time.Now().Add(timeout), cause, key, opts...)
 }
 
 // Cleanup registers a function to be called when the context is canceled.
-func Cleanup(ctx context.Context, f func() error) error {
-	return CleanupWithKey(ctx, doneGroupKey, f)
+// It is safe to call Cleanup from a running cleanup function. The newly registered function is also called and waited for by the same Wait.
+// Note that Wait does not return until no cleanup functions remain, so cleanup functions that keep registering new ones prevent Wait from returning (except for the timeout of WaitWithTimeout).
+// The function is called however the context is canceled, including the cancellation by any ancestor context (e.g. the deadline of the parent).
+// It returns ErrNilFunc if f is nil.
+func Cleanup(ctx context.Context, f func() error, opts ...CleanupOption) error {
+	return CleanupWithKey(ctx, doneGroupKey, f, opts...)
 }
 
 // CleanupWithKey Cleanup registers a function to be called when the context is canceled.
-func CleanupWithKey(ctx context.Context, key any, f func() error) error {
+// It is safe to call CleanupWithKey from a running cleanup function. The newly registered function is also called and waited for by the same Wait.
+func CleanupWithKey(ctx context.Context, key any, f func() error, opts ...CleanupOption) error {
+	if f == nil {
+		return ErrNilFunc
+	}
+	return CleanupWithContextAndKey(ctx, key, func(_ context.Context) error {
+		return f()
+	}, opts...)
+}
+
+// CleanupWithContext registers a function to be called when the context is canceled.
+// The function receives a context that is canceled when the context (ctxw) of WaitWithContext is canceled (or the timeout of WaitWithTimeout has passed).
+// The context keeps the values of the context (e.g. a correlation ID or a logger) when the doneGroup is created by With*.
+func CleanupWithContext(ctx context.Context, f func(ctx context.Context) error, opts ...CleanupOption) error {
+	return CleanupWithContextAndKey(ctx, doneGroupKey, f, opts...)
+}
+
+// CleanupWithContextAndKey registers a function to be called when the context is canceled.
+// The function receives a context that is canceled when the context (ctxw) of WaitWithContext is canceled (or the timeout of WaitWithTimeout has passed).
+// The context keeps the values of the context (e.g. a correlation ID or a logger) when the doneGroup is created by With*.
+func CleanupWithContextAndKey(ctx context.Context, key any, f func(ctx context.Context) error, opts ...CleanupOption) error {
+	if f == nil {
+		return ErrNilFunc
+	}
 	dg, ok := ctx.Value(key).(*doneGroup)
 	if !ok {
 		return ErrNotContainDoneGroup
 	}
+	c := dg.newCleanup(f)
+	for _, opt := range opts {
+		opt(c)
+	}
+	return dg.register(c)
+}
+
+// CleanupContext registers a function to be called when the context is canceled like CleanupWithContext, with its own cancelable context.
+// The returned cancel func cancels only the context passed to the function (e.g. from a watchdog for a stuck cleanup function), not the siblings.
+// If cancel is called before the function is executed, the function receives an already canceled context. Calling cancel after the function finishes is a no-op.
+func CleanupContext(ctx context.Context, f func(ctx context.Context) error) (cancel context.CancelFunc, err error) {
+	return CleanupContextWithKey(ctx, doneGroupKey, f)
+}
+
+// CleanupContextWithKey registers a function to be called when the context is canceled like CleanupWithContextAndKey, with its own cancelable context.
+// The returned cancel func cancels only the context passed to the function (e.g. from a watchdog for a stuck cleanup function), not the siblings.
+// If cancel is called before the function is executed, the function receives an already canceled context. Calling cancel after the function finishes is a no-op.
+func CleanupContextWithKey(ctx context.Context, key any, f func(ctx context.Context) error) (cancel context.CancelFunc, err error) {
+	if f == nil {
+		return nil, ErrNilFunc
+	}
+	abort, cancel := context.WithCancel(context.Background())
+	if err := CleanupWithContextAndKey(ctx, key, func(ctx context.Context) error {
+		defer cancel()
+		ctx, cancelCtx := context.WithCancel(ctx)
+		defer cancelCtx()
+		stop := context.AfterFunc(abort, cancelCtx)
+		defer stop()
+		return f(ctx)
+	}); err != nil {
+		cancel()
+		return nil, err
+	}
+	return cancel, nil
+}
 
-	rootWg := dg.cleanupGroups[0]
+// CleanupWithName registers a function with a name to be called when the context is canceled.
+// The name is passed to the cleanup middlewares (WithCleanupMiddleware).
+func CleanupWithName(ctx context.Context, name string, f func() error) error {
+	return CleanupWithNameAndKey(ctx, doneGroupKey, name, f)
+}
+
+// CleanupWithNameAndKey registers a function with a name to be called when the context is canceled.
+// The name is passed to the cleanup middlewares (WithCleanupMiddleware).
+func CleanupWithNameAndKey(ctx context.Context, key any, name string, f func() error) error {
+	if f == nil {
+		return ErrNilFunc
+	}
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return ErrNotContainDoneGroup
+	}
+	c := dg.newCleanup(func(_ context.Context) error {
+		return f()
+	})
+	c.name = name
+	c.done = make(chan struct{})
+	return dg.register(c)
+}
+
+// Registration is the handle of a cleanup function registered by CleanupWithRegistration.
+type Registration struct {
+	dg *doneGroup
+	c  *cleanup
+}
+
+// IsRegistered reports whether the cleanup function is still registered: it has neither started nor been discarded (Discard).
+// It is intended for idempotent shutdown logic that conditionally discards or waits.
+func (r *Registration) IsRegistered() bool {
+	r.dg.mu.Lock()
+	defer r.dg.mu.Unlock()
+	return slices.Contains(r.dg.cleanups, r.c)
+}
+
+// CleanupWithRegistration registers a function to be called when the context is canceled, and returns the handle of the registration.
+// The Registration is returned with the error if the function is registered anyway (e.g. ErrLateRegistration).
+func CleanupWithRegistration(ctx context.Context, f func() error) (*Registration, error) {
+	return CleanupWithRegistrationAndKey(ctx, doneGroupKey, f)
+}
+
+// CleanupWithRegistrationAndKey registers a function to be called when the context is canceled, and returns the handle of the registration.
+// The Registration is returned with the error if the function is registered anyway (e.g. ErrLateRegistration).
+func CleanupWithRegistrationAndKey(ctx context.Context, key any, f func() error) (*Registration, error) {
+	if f == nil {
+		return nil, ErrNilFunc
+	}
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return nil, ErrNotContainDoneGroup
+	}
+	c := dg.newCleanup(func(_ context.Context) error {
+		return f()
+	})
+	return &Registration{dg: dg, c: c}, dg.register(c)
+}
+
+// WaitForCleanup blocks until the cleanup functions registered by CleanupWithName with the name finish, and returns their errors.
+// It lets the code outside the doneGroup synchronize with an individual step of the shutdown without waiting for all the cleanup functions.
+// If no cleanup function with the name is registered, it returns ErrCleanupNotFound. If the cleanup functions are discarded by Discard, it returns nil.
+func WaitForCleanup(ctx context.Context, name string) error {
+	return WaitForCleanupWithKey(ctx, doneGroupKey, name)
+}
+
+// WaitForCleanupWithKey blocks until the cleanup functions registered by CleanupWithNameAndKey with the name finish, and returns their errors.
+// It lets the code outside the doneGroup synchronize with an individual step of the shutdown without waiting for all the cleanup functions.
+// If no cleanup function with the name is registered, it returns ErrCleanupNotFound. If the cleanup functions are discarded by DiscardWithKey, it returns nil.
+func WaitForCleanupWithKey(ctx context.Context, key any, name string) error {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return ErrNotContainDoneGroup
+	}
 	dg.mu.Lock()
-	rootWg.Add(1)
+	cs := slices.Clone(dg.named[name])
+	dg.mu.Unlock()
+	if len(cs) == 0 {
+		return fmt.Errorf("%w: %s", ErrCleanupNotFound, name)
+	}
+	var errs []error
+	for _, c := range cs {
+		<-c.done
+		errs = append(errs, c.err)
+	}
+	return errors.Join(errs...)
+}
+
+// CleanupTagged registers a function with a tag to be called when the context is canceled.
+// Unlike the name of CleanupWithName, the tag is intended to be shared by many cleanup functions for the same type of resource (e.g. "db-conn").
+// The counts and the total execution time of the cleanup functions are aggregated per tag, and can be retrieved by Tags.
+func CleanupTagged(ctx context.Context, tag string, f func() error) error {
+	return CleanupTaggedWithKey(ctx, doneGroupKey, tag, f)
+}
+
+// CleanupTaggedWithKey registers a function with a tag to be called when the context is canceled.
+// Unlike the name of CleanupWithNameAndKey, the tag is intended to be shared by many cleanup functions for the same type of resource (e.g. "db-conn").
+// The counts and the total execution time of the cleanup functions are aggregated per tag, and can be retrieved by TagsWithKey.
+func CleanupTaggedWithKey(ctx context.Context, key any, tag string, f func() error) error {
+	if f == nil {
+		return ErrNilFunc
+	}
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return ErrNotContainDoneGroup
+	}
+	c := dg.newCleanup(func(_ context.Context) error {
+		return f()
+	})
+	c.tag = tag
+	return dg.register(c)
+}
+
+// CleanupOncePerContext registers a function to be called when the context is canceled, only once per token.
+// It returns true if the function is registered by this call.
+func CleanupOncePerContext(ctx context.Context, token any, f func() error) (bool, error) {
+	return CleanupOncePerContextWithKey(ctx, doneGroupKey, token, f)
+}
+
+// CleanupOncePerContextWithKey registers a function to be called when the context is canceled, only once per token.
+// It returns true if the function is registered by this call.
+func CleanupOncePerContextWithKey(ctx context.Context, key, token any, f func() error) (bool, error) {
+	if f == nil {
+		return false, ErrNilFunc
+	}
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return false, ErrNotContainDoneGroup
+	}
+	dg.mu.Lock()
+	if dg.tokens == nil {
+		dg.tokens = map[any]struct{}{}
+	}
+	if _, ok := dg.tokens[token]; ok {
+		dg.mu.Unlock()
+		return false, nil
+	}
+	dg.tokens[token] = struct{}{}
 	dg.mu.Unlock()
+	if err := CleanupWithKey(ctx, key, f); err != nil {
+		return false, err
+	}
+	return true, nil
+}
 
-	_ = context.AfterFunc(ctx, func() {
-		if err := f(); err != nil {
-			dg.mu.Lock()
-			dg.errors = errors.Join(dg.errors, err)
-			dg.mu.Unlock()
+// CleanupEscalating registers a function to be called when the context is canceled.
+// The graceful function is called first, and if it does not finish within soft, the forceful function is called.
+// When escalated, the error contains ErrCleanupEscalated (and the error of the forceful function).
+// The error of the graceful function returned after escalation is also collected.
+func CleanupEscalating(ctx context.Context, soft time.Duration, graceful, forceful func() error) error {
+	return CleanupEscalatingWithKey(ctx, doneGroupKey, soft, graceful, forceful)
+}
+
+// CleanupEscalatingWithKey registers a function to be called when the context is canceled.
+// The graceful function is called first, and if it does not finish within soft, the forceful function is called.
+// When escalated, the error contains ErrCleanupEscalated (and the error of the forceful function).
+// The error of the graceful function returned after escalation is also collected.
+func CleanupEscalatingWithKey(ctx context.Context, key any, soft time.Duration, graceful, forceful func() error) error {
+	if graceful == nil || forceful == nil {
+		return ErrNilFunc
+	}
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return ErrNotContainDoneGroup
+	}
+	return CleanupWithKey(ctx, key, func() error {
+		ch := make(chan error, 1)
+		go func() {
+			ch <- graceful()
+		}()
+		t := time.NewTimer(soft)
+		defer t.Stop()
+		select {
+		case err := <-ch:
+			return err
+		case <-t.C:
 		}
-		rootWg.Done()
+		errEscalated := ErrCleanupEscalated
+		if err := forceful(); err != nil {
+			errEscalated = fmt.Errorf("%w: %w", ErrCleanupEscalated, err)
+		}
+		select {
+		case err := <-ch:
+			return errors.Join(err, errEscalated)
+		default:
+			go func() {
+				if err := <-ch; err != nil {
+					dg.appendError(err)
+				}
+			}()
+		}
+		return errEscalated
 	})
+}
+
+// CleanupPreCancel registers a function to be called when the cancellation is requested, before the context (and its descendants) is actually canceled.
+// It requires WithPreCancelBarrier, otherwise it returns ErrNoPreCancelBarrier. If the cancellation has already been requested, it returns ErrAlreadyCanceled.
+// The errors are collected into the doneGroup like the cleanup functions.
+func CleanupPreCancel(ctx context.Context, f func() error) error {
+	return CleanupPreCancelWithKey(ctx, doneGroupKey, f)
+}
+
+// CleanupPreCancelWithKey registers a function to be called when the cancellation is requested, before the context (and its descendants) is actually canceled.
+// It requires WithPreCancelBarrier, otherwise it returns ErrNoPreCancelBarrier. If the cancellation has already been requested, it returns ErrAlreadyCanceled.
+// The errors are collected into the doneGroup like the cleanup functions.
+func CleanupPreCancelWithKey(ctx context.Context, key any, f func() error) error {
+	if f == nil {
+		return ErrNilFunc
+	}
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return ErrNotContainDoneGroup
+	}
+	if !dg.config.preCancelBarrier || dg.cancel == nil {
+		return ErrNoPreCancelBarrier
+	}
+	dg.mu.Lock()
+	defer dg.mu.Unlock()
+	if dg.preCancelDone || ctx.Err() != nil {
+		return ErrAlreadyCanceled
+	}
+	// Wait also waits for the pre-cancel function, as it may run after the context is canceled (e.g. by the deadline)
+	dg.cleanupGroups[0].Add(1)
+	dg.preCancel = append(dg.preCancel, f)
 	return nil
 }
 
+// CleanupWithTimeout registers a function to be called when the context is canceled, with its own timeout.
+// The function receives a context that is canceled when the timeout has passed, and the timeout is recorded as an error wrapping context.DeadlineExceeded.
+// It overrides the default timeout set by WithPerCleanupTimeout.
+func CleanupWithTimeout(ctx context.Context, timeout time.Duration, f func(ctx context.Context) error) error {
+	return CleanupWithTimeoutAndKey(ctx, timeout, doneGroupKey, f)
+}
+
+// CleanupWithTimeoutAndKey registers a function to be called when the context is canceled, with its own timeout.
+// The function receives a context that is canceled when the timeout has passed, and the timeout is recorded as an error wrapping context.DeadlineExceeded.
+// It overrides the default timeout set by WithPerCleanupTimeout.
+func CleanupWithTimeoutAndKey(ctx context.Context, timeout time.Duration, key any, f func(ctx context.Context) error) error {
+	return CleanupWithContextAndKey(ctx, key, f, CleanupTimeout(timeout))
+}
+
+// CleanupInPhase registers a function to be called in the phase when the context is canceled.
+// The phases are executed in ascending order: the cleanup functions of a phase start after all the cleanup functions of the lower phases finish.
+// The cleanup functions within a phase are executed concurrently (subject to WithMaxConcurrentCleanups). Cleanup registers functions in PhaseNormal.
+// The errors of all phases are aggregated.
+func CleanupInPhase(ctx context.Context, phase Phase, f func() error) error {
+	return CleanupInPhaseWithKey(ctx, doneGroupKey, phase, f)
+}
+
+// CleanupInPhaseWithKey registers a function to be called in the phase when the context is canceled.
+// The phases are executed in ascending order: the cleanup functions of a phase start after all the cleanup functions of the lower phases finish.
+// The cleanup functions within a phase are executed concurrently (subject to WithMaxConcurrentCleanups). CleanupWithKey registers functions in PhaseNormal.
+// The errors of all phases are aggregated.
+func CleanupInPhaseWithKey(ctx context.Context, key any, phase Phase, f func() error) error {
+	return CleanupWithKey(ctx, key, f, InPhase(phase))
+}
+
+// CleanupIf registers a function to be called when the context is canceled if cond returns true.
+// cond is evaluated when the cleanup function is executed after the cancellation, so it can depend on the runtime state (e.g. whether a feature was activated).
+// If cond returns false, the function is skipped, but it is still accounted as a finished cleanup function.
+func CleanupIf(ctx context.Context, cond func() bool, f func() error) error {
+	return CleanupIfWithKey(ctx, doneGroupKey, cond, f)
+}
+
+// CleanupIfWithKey registers a function to be called when the context is canceled if cond returns true.
+// cond is evaluated when the cleanup function is executed after the cancellation, so it can depend on the runtime state (e.g. whether a feature was activated).
+// If cond returns false, the function is skipped, but it is still accounted as a finished cleanup function.
+func CleanupIfWithKey(ctx context.Context, key any, cond func() bool, f func() error) error {
+	if cond == nil || f == nil {
+		return ErrNilFunc
+	}
+	return CleanupWithKey(ctx, key, func() error {
+		if !cond() {
+			return nil
+		}
+		return f()
+	})
+}
+
+// CleanupOrSkip registers a function to be called when the context is canceled if the context contains a doneGroup.
+// Otherwise, it does nothing. It returns true if the function is registered.
+// It panics with ErrNilFunc if f is nil.
+func CleanupOrSkip(ctx context.Context, f func() error) bool {
+	return CleanupOrSkipWithKey(ctx, doneGroupKey, f)
+}
+
+// CleanupOrSkipWithKey registers a function to be called when the context is canceled if the context contains a doneGroup.
+// Otherwise, it does nothing. It returns true if the function is registered.
+// It panics with ErrNilFunc if f is nil.
+func CleanupOrSkipWithKey(ctx context.Context, key any, f func() error) bool {
+	if f == nil {
+		panic(ErrNilFunc)
+	}
+	// The function is still registered with the other errors (e.g. ErrLateRegistration)
+	return !errors.Is(CleanupWithKey(ctx, key, f), ErrNotContainDoneGroup)
+}
+
 // Wait blocks until the context is canceled. Then calls the function registered by Cleanup.
+// It also waits for the cleanup functions of the descendant doneGroups and returns the errors of the entire subtree.
+// If the default wait timeout is set by WithWaitTimeout, it waits like WaitWithTimeout. If WithInheritDeadlineForWait is set, it also gives up at the deadline of the context.
+// It is safe to call Wait for a distinct doneGroup (e.g. a child context owned by the cleanup function) from a running cleanup function.
+// Wait for the doneGroup (or an ancestor) of the running cleanup function with the context passed by CleanupWithContext returns ErrWaitInCleanup instead of deadlocking.
+// Note that it cannot be detected with the other contexts.
+// It is safe to call Wait from multiple goroutines concurrently. The cleanup functions are called only once, and all the callers get the same aggregated error (unless some of them time out).
 func Wait(ctx context.Context) error {
 	return WaitWithKey(ctx, doneGroupKey)
 }
 
+// WaitWithAggregator blocks until the context is canceled. Then calls the function registered by Cleanup, and returns the errors aggregated by agg.
+// It is useful to aggregate the errors differently at a specific call site (e.g. a human-readable summary for a CLI).
+// The aggregator applies only to this call: the other callers of Wait get the errors joined by errors.Join.
+// If there are no errors, agg is not called and it returns nil.
+// If the default wait timeout is set by WithWaitTimeout, it waits like WaitWithTimeout. If WithInheritDeadlineForWait is set, it also gives up at the deadline of the context.
+func WaitWithAggregator(ctx context.Context, agg func([]error) error) error {
+	return WaitWithAggregatorAndKey(ctx, doneGroupKey, agg)
+}
+
 // WaitWithTimeout blocks until the context (ctx) is canceled. Then calls the function registered by Cleanup with timeout.
 func WaitWithTimeout(ctx context.Context, timeout time.Duration) error {
 	return WaitWithTimeoutAndKey(ctx, timeout, doneGroupKey)
@@ -138,19 +732,82 @@ func WaitWithContext(ctx, ctxw context.Context) error {
 	return WaitWithContextAndKey(ctx, ctxw, doneGroupKey)
 }
 
+// WaitWithCleanupContext blocks until the context (ctx) is canceled. Then calls the function registered by Cleanup with context (ctxw) like WaitWithContext.
+// Unlike WaitWithContext, the contexts passed to the cleanup functions (CleanupWithContext) are derived from ctxw instead of ctx,
+// so the values and the deadline of ctxw (e.g. the reason of the shutdown) are visible to them, and they are canceled when ctxw is done. The values of ctx (including the doneGroup) are not visible.
+// It applies to the cleanup functions of the doneGroup and its descendants that start after it is called, so call it before the context is canceled (e.g. blocking on it in main).
+func WaitWithCleanupContext(ctx, ctxw context.Context) error {
+	return WaitWithCleanupContextAndKey(ctx, ctxw, doneGroupKey)
+}
+
+// WaitWithGrace blocks until the context is canceled. Then calls the function registered by Cleanup with timeout.
+// It does not return until at least minGrace has elapsed since the context was canceled, unless the timeout is exceeded.
+// If the timeout is exceeded before minGrace has elapsed (e.g. minGrace is greater than timeout), it returns ErrWaitTimeout even if the cleanup functions have finished.
+func WaitWithGrace(ctx context.Context, minGrace, timeout time.Duration) error {
+	return WaitWithGraceAndKey(ctx, minGrace, timeout, doneGroupKey)
+}
+
+// WaitWithTimeouts blocks until the context is canceled. Then calls the function registered by Cleanup with two-stage timeouts.
+// When the soft timeout has passed, the contexts passed to the cleanup functions (CleanupWithContext) are canceled to stop them cooperatively.
+// When the hard timeout has passed, it returns regardless with ErrWaitTimeout and the error reporting the cleanup functions that ignored the soft cancellation.
+func WaitWithTimeouts(ctx context.Context, soft, hard time.Duration) error {
+	return WaitWithTimeoutsAndKey(ctx, soft, hard, doneGroupKey)
+}
+
+// WaitAndCancel cancels the context if it is not canceled yet. Then blocks until the cleanup functions registered by Cleanup finish.
+// If the context is already canceled, the original cause is preserved.
+func WaitAndCancel(ctx context.Context) error {
+	return WaitAndCancelWithKey(ctx, doneGroupKey)
+}
+
+// Closer returns an io.Closer whose Close cancels the context and waits for the cleanup functions like WaitAndCancel, and returns the aggregated error.
+// It lets the doneGroup slot into code that manages io.Closer, e.g. registering a child doneGroup as a cleanup function of the parent: Cleanup(parent, Closer(child).Close).
+// Close waits without timeout unless the default wait timeout is set by WithWaitTimeout.
+func Closer(ctx context.Context) io.Closer {
+	return CloserWithKey(ctx, doneGroupKey)
+}
+
+// CloserWithKey returns an io.Closer whose Close cancels the context and waits for the cleanup functions like WaitAndCancelWithKey, and returns the aggregated error.
+// It lets the doneGroup slot into code that manages io.Closer, e.g. registering a child doneGroup as a cleanup function of the parent: CleanupWithKey(parent, key, CloserWithKey(child, key).Close).
+// Close waits without timeout unless the default wait timeout is set by WithWaitTimeout.
+func CloserWithKey(ctx context.Context, key any) io.Closer {
+	return &closer{ctx: ctx, key: key}
+}
+
+// closer is the io.Closer returned by CloserWithKey.
+type closer struct {
+	ctx context.Context
+	key any
+}
+
+// Close cancels the context and waits for the cleanup functions.
+func (c *closer) Close() error {
+	return WaitAndCancelWithKey(c.ctx, c.key)
+}
+
 // Cancel cancels the context. Then calls the function registered by Cleanup.
+// It is safe to call Cancel (and CancelWithCause) from multiple goroutines concurrently. The cleanup functions are called only once regardless of the number of calls.
 func Cancel(ctx context.Context) error {
 	return CancelWithKey(ctx, doneGroupKey)
 }
 
 // CancelWithCause cancels the context with cause. Then calls the function registered by Cleanup.
+// If the context is already canceled, it returns ErrAlreadyCanceled and the cause is not changed (the first cause wins).
+// When called from multiple goroutines concurrently, exactly one call returns nil and its cause is set.
 func CancelWithCause(ctx context.Context, cause error) error {
 	return CancelWithCauseAndKey(ctx, cause, doneGroupKey)
 }
 
 // WaitWithKey blocks until the context is canceled. Then calls the function registered by Cleanup.
+// If the default wait timeout is set by WithWaitTimeout, it waits like WaitWithTimeoutAndKey. If WithInheritDeadlineForWait is set, it also gives up at the deadline of the context.
 func WaitWithKey(ctx context.Context, key any) error {
-	return WaitWithContextAndKey(ctx, context.WithoutCancel(ctx), key)
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return ErrNotContainDoneGroup
+	}
+	ctxw, cancel := dg.defaultWaitContext(ctx)
+	defer cancel()
+	return WaitWithContextAndKey(ctx, ctxw, key)
 }
 
 // WaitWithTimeoutAndKey blocks until the context is canceled. Then calls the function registered by Cleanup with timeout.
@@ -160,79 +817,425 @@ func WaitWithTimeoutAndKey(ctx context.Context, timeout time.Duration, key any)
 	return WaitWithContextAndKey(ctx, ctxw, key)
 }
 
-// WaitWithContextAndKey blocks until the context is canceled. Then calls the function registered by Cleanup with context (ctxx).
-func WaitWithContextAndKey(ctx, ctxw context.Context, key any) error {
+// WaitAndCancelWithKey cancels the context if it is not canceled yet. Then blocks until the cleanup functions registered by Cleanup finish.
+// If the context is already canceled, the original cause is preserved.
+func WaitAndCancelWithKey(ctx context.Context, key any) error {
+	if ctx.Err() == nil {
+		if err := CancelWithKey(ctx, key); err != nil {
+			return err
+		}
+	}
+	return WaitWithKey(ctx, key)
+}
+
+// WaitWithTimeoutsAndKey blocks until the context is canceled. Then calls the function registered by Cleanup with two-stage timeouts.
+// When the soft timeout has passed, the contexts passed to the cleanup functions (CleanupWithContextAndKey) are canceled to stop them cooperatively.
+// When the hard timeout has passed, it returns regardless with ErrWaitTimeout and the error reporting the cleanup functions that ignored the soft cancellation.
+func WaitWithTimeoutsAndKey(ctx context.Context, soft, hard time.Duration, key any) error {
 	dg, ok := ctx.Value(key).(*doneGroup)
 	if !ok {
 		return ErrNotContainDoneGroup
 	}
-	<-ctx.Done()
-	wg := &sync.WaitGroup{}
-	for _, g := range dg.cleanupGroups {
-		wg.Add(1)
-		dg.mu.Lock()
-		go func() {
-			g.Wait()
-			wg.Done()
-		}()
-		dg.mu.Unlock()
+	ctxw, cancel := context.WithTimeout(context.WithoutCancel(ctx), hard)
+	defer cancel()
+	t := time.AfterFunc(soft, func() {
+		dg.cancelCleanups(context.DeadlineExceeded)
+	})
+	defer t.Stop()
+	err := WaitWithContextAndKey(ctx, ctxw, key)
+	if ctxw.Err() == nil || dg.config.registrationStacks {
+		// The registration stacks of the still running cleanup functions are already reported
+		return err
 	}
-	ch := make(chan struct{})
-	go func() {
-		wg.Wait()
-		close(ch)
-	}()
-	select {
-	case <-ch:
-	case <-ctxw.Done():
-		dg.mu.Lock()
-		defer dg.mu.Unlock()
-		dg.errors = errors.Join(dg.errors, ctxw.Err())
+	if n := dg.pendingCleanups(); n > 0 {
+		err = errors.Join(err, fmt.Errorf("donegroup: %d cleanup functions ignored the soft timeout", n))
 	}
-	return dg.errors
-}
-
-// CancelWithKey cancels the context.
-func CancelWithKey(ctx context.Context, key any) error {
-	return CancelWithCauseAndKey(ctx, nil, key)
+	return err
 }
 
-// CancelWithCauseAndKey cancels the context with cause.
-func CancelWithCauseAndKey(ctx context.Context, cause error, key any) error {
+// WaitWithGraceAndKey blocks until the context is canceled. Then calls the function registered by Cleanup with timeout.
+// It does not return until at least minGrace has elapsed since the context was canceled, unless the timeout is exceeded.
+// If the timeout is exceeded before minGrace has elapsed (e.g. minGrace is greater than timeout), it returns ErrWaitTimeout even if the cleanup functions have finished.
+func WaitWithGraceAndKey(ctx context.Context, minGrace, timeout time.Duration, key any) error {
 	dg, ok := ctx.Value(key).(*doneGroup)
 	if !ok {
 		return ErrNotContainDoneGroup
 	}
-	dg.cancel(cause)
-	return nil
+	ctxw, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+	err := WaitWithContextAndKey(ctx, ctxw, key)
+	if ctxw.Err() != nil {
+		return err
+	}
+	if d := minGrace - time.Since(dg.canceledTime()); d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctxw.Done():
+			// The grace period is cut by the timeout
+			return errors.Join(err, fmt.Errorf("%w: %w", ErrWaitTimeout, ctxw.Err()))
+		}
+	}
+	return err
 }
 
-// Awaiter returns a function that guarantees execution of the process until it is called.
-// Note that if the timeout of WaitWithTimeout has passed (or the context of WaitWithContext has canceled), it will not wait.
-func Awaiter(ctx context.Context) (completed func(), err error) {
-	return AwaiterWithKey(ctx, doneGroupKey)
+// WaitWithContextAndKey blocks until the context is canceled. Then calls the function registered by Cleanup with context (ctxx).
+// If ctxw is nil, it waits without bound.
+func WaitWithContextAndKey(ctx, ctxw context.Context, key any) error {
+	return waitWithContext(ctx, ctxw, key, joinErrors)
 }
 
-// AwaiterWithKey returns a function that guarantees execution of the process until it is called.
-// Note that if the timeout of WaitWithTimeout has passed (or the context of WaitWithContext has canceled), it will not wait.
-func AwaiterWithKey(ctx context.Context, key any) (completed func(), err error) {
-	ctxx, completed := context.WithCancel(context.WithoutCancel(ctx)) //nolint:govet
-	if err := CleanupWithKey(ctx, key, func() error {
-		<-ctxx.Done()
-		return nil
-	}); err != nil {
-		return nil, err //nolint:govet
+// WaitWithCleanupContextAndKey blocks until the context (ctx) is canceled. Then calls the function registered by Cleanup with context (ctxw) like WaitWithContextAndKey.
+// Unlike WaitWithContextAndKey, the contexts passed to the cleanup functions (CleanupWithContextAndKey) are derived from ctxw instead of ctx,
+// so the values and the deadline of ctxw (e.g. the reason of the shutdown) are visible to them, and they are canceled when ctxw is done. The values of ctx (including the doneGroup) are not visible.
+// It applies to the cleanup functions of the doneGroup and its descendants that start after it is called, so call it before the context is canceled (e.g. blocking on it in main).
+func WaitWithCleanupContextAndKey(ctx, ctxw context.Context, key any) error {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return ErrNotContainDoneGroup
 	}
-	return completed, nil
+	dg.setCleanupBase(ctxw)
+	return WaitWithContextAndKey(ctx, ctxw, key)
 }
 
-// Awaitable returns a function that guarantees execution of the process until it is called.
-// Note that if the timeout of WaitWithTimeout has passed (or the context of WaitWithContext has canceled), it will not wait.
-func Awaitable(ctx context.Context) (completed func()) {
-	return AwaitableWithKey(ctx, doneGroupKey)
+// WaitWithAggregatorAndKey blocks until the context is canceled. Then calls the function registered by Cleanup, and returns the errors aggregated by agg.
+// The aggregator applies only to this call: the other callers of WaitWithKey get the errors joined by errors.Join.
+// If there are no errors, agg is not called and it returns nil.
+// If the default wait timeout is set by WithWaitTimeout, it waits like WaitWithTimeoutAndKey. If WithInheritDeadlineForWait is set, it also gives up at the deadline of the context.
+func WaitWithAggregatorAndKey(ctx context.Context, key any, agg func([]error) error) error {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return ErrNotContainDoneGroup
+	}
+	ctxw, cancel := dg.defaultWaitContext(ctx)
+	defer cancel()
+	return waitWithContext(ctx, ctxw, key, agg)
 }
 
-// AwaitableWithKey returns a function that guarantees execution of the process until it is called.
+// noopCancel is the cancel func returned when there is nothing to cancel, to avoid the allocation per Wait.
+var noopCancel context.CancelFunc = func() {}
+
+// defaultWaitContext returns the context bounding the wait by the default wait timeout (WithWaitTimeout) and the inherited deadline (WithInheritDeadlineForWait).
+// The context is nil if neither is set.
+func (dg *doneGroup) defaultWaitContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, inherit := ctx.Deadline()
+	inherit = inherit && dg.config.inheritDeadlineForWait
+	if timeout := dg.config.waitTimeout; timeout > 0 {
+		if d := time.Now().Add(timeout); !inherit || d.Before(deadline) {
+			deadline = d
+		}
+	} else if !inherit {
+		return nil, noopCancel
+	}
+	return context.WithDeadline(context.WithoutCancel(ctx), deadline)
+}
+
+// waitWithContext is the implementation of WaitWithContextAndKey that aggregates the errors with agg.
+func waitWithContext(ctx, ctxw context.Context, key any, agg func([]error) error) error {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return ErrNotContainDoneGroup
+	}
+	if running, ok := ctx.Value(cleanupCtxKey{}).(*doneGroup); ok {
+		// Waiting for the doneGroup (or an ancestor) of the running cleanup function never finishes
+		for d := running; d != nil; d = d.parent {
+			if d == dg {
+				return ErrWaitInCleanup
+			}
+		}
+	}
+	dg.mu.Lock()
+	if dg.unused {
+		dg.mu.Unlock()
+		return nil
+	}
+	dg.waiting++
+	dg.leakConsumed()
+	dg.mu.Unlock()
+	var done <-chan struct{}
+	if ctxw != nil {
+		dg.setWaitDeadline(ctxw)
+		done = ctxw.Done()
+	}
+	defer func() {
+		dg.mu.Lock()
+		dg.waiting--
+		dg.waitReturned = true
+		last := dg.waiting == 0
+		dg.mu.Unlock()
+		if last {
+			dg.discardStores()
+		}
+	}()
+	<-ctx.Done()
+	if dg.idle() {
+		// Fast path: there is nothing to wait for
+		return dg.aggregateErrors(agg)
+	}
+	defer dg.startHeartbeat()()
+	if done == nil {
+		// Without the waiting context, there is nothing to select
+		dg.waitCleanupGroupsSync()
+		return dg.aggregateErrors(agg)
+	}
+	select {
+	case <-dg.waitCleanupGroups():
+	case <-done:
+		// The processes started by GoRequired are waited for past the timeout, up to the hard limit
+		required := dg.waitRequiredGo()
+		dg.cancelCleanups(context.Cause(ctxw))
+		stillRunning := dg.stillRunningErrors()
+		dg.mu.Lock()
+		dg.errors = append(dg.errors, fmt.Errorf("%w: %w", ErrWaitTimeout, ctxw.Err()))
+		if required != nil {
+			dg.errors = append(dg.errors, required)
+		}
+		if stillRunning != nil {
+			dg.errors = append(dg.errors, stillRunning)
+		}
+		if dg.config.abandonOnWaitTimeout {
+			dg.abandoned = true
+		}
+		dg.mu.Unlock()
+	}
+	return dg.aggregateErrors(agg)
+}
+
+// startHeartbeat starts calling the heartbeat function of WithHeartbeat periodically from a goroutine, and returns a function to stop it.
+// The stop function returns after the goroutine exits, so the heartbeat function is not called after it.
+func (dg *doneGroup) startHeartbeat() (stop func()) {
+	f, interval := dg.config.heartbeat, dg.config.heartbeatInterval
+	if f == nil || interval <= 0 {
+		return func() {}
+	}
+	stopc := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-stopc:
+				return
+			case <-t.C:
+				f()
+			}
+		}
+	}()
+	return func() {
+		close(stopc)
+		<-finished
+	}
+}
+
+// joinErrors is the default aggregator of the errors.
+func joinErrors(errs []error) error {
+	return errors.Join(errs...)
+}
+
+// aggregateErrors returns the errors collected by the doneGroup aggregated by agg, or nil if there are no errors.
+func (dg *doneGroup) aggregateErrors(agg func([]error) error) error {
+	dg.mu.Lock()
+	errs := slices.Clone(dg.errors)
+	dg.mu.Unlock()
+	if len(errs) == 0 {
+		return nil
+	}
+	return agg(errs)
+}
+
+// WaitKeysInOrder waits for the doneGroups of the keys one by one in the given order.
+// Errors of all doneGroups are aggregated. If the context does not contain a doneGroup of a key, ErrNotContainDoneGroup is joined and it continues with the next key.
+// Note that the cleanup functions of each doneGroup start when its context is canceled, so the order applies to waiting, not to the start of execution.
+func WaitKeysInOrder(ctx context.Context, keys ...any) error {
+	var errs error
+	for _, key := range keys {
+		if err := WaitWithKey(ctx, key); err != nil {
+			errs = errors.Join(errs, err)
+		}
+	}
+	return errs
+}
+
+// CancelWithKey cancels the context.
+func CancelWithKey(ctx context.Context, key any) error {
+	if err := CancelWithCauseAndKey(ctx, nil, key); err != nil && !errors.Is(err, ErrAlreadyCanceled) {
+		return err
+	}
+	return nil
+}
+
+// CancelWithCauseAndKey cancels the context with cause.
+// If the context is already canceled, it returns ErrAlreadyCanceled and the cause is not changed (the first cause wins).
+func CancelWithCauseAndKey(ctx context.Context, cause error, key any) error {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return ErrNotContainDoneGroup
+	}
+	return dg.cancelWithCause(cause, callerStack)
+}
+
+// cancelWithCause cancels the context of the doneGroup with the cause, recording the call and the stack returned by stack (if WithCancellerStack is set).
+func (dg *doneGroup) cancelWithCause(cause error, stack func() string) error {
+	if dg.cancel == nil {
+		return ErrNotCancelable
+	}
+	dg.mu.Lock()
+	if dg.cancelCalled || dg.ctx.Err() != nil {
+		dg.mu.Unlock()
+		return ErrAlreadyCanceled
+	}
+	dg.cancelCalled = true
+	if dg.config.cancellerStack {
+		dg.cancellerStack = []byte(stack())
+	}
+	dg.mu.Unlock()
+	dg.cancel(cause)
+	return nil
+}
+
+// CancelWithCauses cancels the context with the cause joining the causes by errors.Join. Then calls the function registered by Cleanup.
+// errors.Is on context.Cause(ctx) reports true for each of the causes.
+// If the context is already canceled, it returns ErrAlreadyCanceled and the cause is not changed (the first cause wins).
+func CancelWithCauses(ctx context.Context, causes ...error) error {
+	return CancelWithCausesAndKey(ctx, doneGroupKey, causes...)
+}
+
+// CancelWithCausesAndKey cancels the context with the cause joining the causes by errors.Join. Then calls the function registered by Cleanup.
+// errors.Is on context.Cause(ctx) reports true for each of the causes.
+// If the context is already canceled, it returns ErrAlreadyCanceled and the cause is not changed (the first cause wins).
+func CancelWithCausesAndKey(ctx context.Context, key any, causes ...error) error {
+	return CancelWithCauseAndKey(ctx, errors.Join(causes...), key)
+}
+
+// CauseFunc returns the cancel func with cause of the context, even if the context is created by WithCancel (not WithCancelCause).
+// It returns ErrNotCancelable if the doneGroup does not have its own cancel func (e.g. WithInheritedCancel).
+func CauseFunc(ctx context.Context) (context.CancelCauseFunc, error) {
+	return CauseFuncWithKey(ctx, doneGroupKey)
+}
+
+// CauseFuncWithKey returns the cancel func with cause of the context, even if the context is created by WithCancelWithKey (not WithCancelCauseWithKey).
+// It returns ErrNotCancelable if the doneGroup does not have its own cancel func (e.g. WithInheritedCancelWithKey).
+func CauseFuncWithKey(ctx context.Context, key any) (context.CancelCauseFunc, error) {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return nil, ErrNotContainDoneGroup
+	}
+	if dg.cancel == nil {
+		return nil, ErrNotCancelable
+	}
+	return dg.cancel, nil
+}
+
+// Discard deregisters all the cleanup functions that have not started yet, without calling them.
+// Then a subsequent Cancel and Wait do not call them.
+// It is intended for cases where the cleanup should be done by others (e.g. a child process after fork/exec).
+// Note that it is dangerous because the resources are never released by the discarded cleanup functions.
+// Cleanup functions that have already started, cleanup functions registered with the descendant contexts, and processes guarded by Awaiter or Go are not affected.
+func Discard(ctx context.Context) error {
+	return DiscardWithKey(ctx, doneGroupKey)
+}
+
+// DiscardWithKey deregisters all the cleanup functions that have not started yet, without calling them.
+// Then a subsequent Cancel and Wait do not call them.
+// It is intended for cases where the cleanup should be done by others (e.g. a child process after fork/exec).
+// Note that it is dangerous because the resources are never released by the discarded cleanup functions.
+// Cleanup functions that have already started, cleanup functions registered with the descendant contexts, and processes guarded by Awaiter or Go are not affected.
+func DiscardWithKey(ctx context.Context, key any) error {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return ErrNotContainDoneGroup
+	}
+	rootWg := dg.cleanupGroups[0]
+	dg.mu.Lock()
+	defer dg.mu.Unlock()
+	for _, c := range dg.cleanups {
+		if c.done != nil {
+			// Release WaitForCleanup for the discarded cleanup function
+			close(c.done)
+		}
+		if c.tag != "" {
+			dg.tags[c.tag].Pending--
+		}
+		rootWg.Done()
+	}
+	dg.pending -= len(dg.cleanups)
+	dg.cleanups = nil
+	return nil
+}
+
+// MarkUnused marks the doneGroup as unused, asserting that there is nothing to clean up (e.g. a request that short-circuited).
+// After that, Cleanup does not register functions, and Wait returns nil immediately without waiting for anything.
+// If cleanup functions have already been registered, they are discarded (like Discard) and ErrCleanupRegistered is returned.
+func MarkUnused(ctx context.Context) error {
+	return MarkUnusedWithKey(ctx, doneGroupKey)
+}
+
+// MarkUnusedWithKey marks the doneGroup as unused, asserting that there is nothing to clean up (e.g. a request that short-circuited).
+// After that, CleanupWithKey does not register functions, and WaitWithKey returns nil immediately without waiting for anything.
+// If cleanup functions have already been registered, they are discarded (like DiscardWithKey) and ErrCleanupRegistered is returned.
+func MarkUnusedWithKey(ctx context.Context, key any) error {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return ErrNotContainDoneGroup
+	}
+	if err := DiscardWithKey(ctx, key); err != nil {
+		return err
+	}
+	dg.mu.Lock()
+	defer dg.mu.Unlock()
+	dg.unused = true
+	if dg.registered > 0 {
+		return ErrCleanupRegistered
+	}
+	return nil
+}
+
+// Awaiter returns a function that guarantees execution of the process until it is called.
+// Note that if the timeout of WaitWithTimeout has passed (or the context of WaitWithContext has canceled), it will not wait.
+func Awaiter(ctx context.Context) (completed func(), err error) {
+	return AwaiterWithKey(ctx, doneGroupKey)
+}
+
+// AwaiterWithKey returns a function that guarantees execution of the process until it is called.
+// Note that if the timeout of WaitWithTimeout has passed (or the context of WaitWithContext has canceled), it will not wait.
+func AwaiterWithKey(ctx context.Context, key any) (completed func(), err error) {
+	return AddTaskWithKey(ctx, key)
+}
+
+// AwaiterWithDeadline returns a function that guarantees execution of the process until it is called, and the deadline when the wait gives up.
+// The deadline is known (ok is true) once WaitWithTimeout (or WaitWithContext with a deadline) has begun; before that, ok is false.
+// The deadline is not updated after it returns, so call it again to get the latest one.
+// Note that if the timeout of WaitWithTimeout has passed (or the context of WaitWithContext has canceled), it will not wait.
+func AwaiterWithDeadline(ctx context.Context) (deadline time.Time, ok bool, completed func(), err error) {
+	return AwaiterWithDeadlineAndKey(ctx, doneGroupKey)
+}
+
+// AwaiterWithDeadlineAndKey returns a function that guarantees execution of the process until it is called, and the deadline when the wait gives up.
+// The deadline is known (ok is true) once WaitWithTimeoutAndKey (or WaitWithContextAndKey with a deadline) has begun; before that, ok is false.
+// The deadline is not updated after it returns, so call it again to get the latest one.
+// Note that if the timeout of WaitWithTimeout has passed (or the context of WaitWithContext has canceled), it will not wait.
+func AwaiterWithDeadlineAndKey(ctx context.Context, key any) (deadline time.Time, ok bool, completed func(), err error) {
+	dg, found := ctx.Value(key).(*doneGroup)
+	if !found {
+		return time.Time{}, false, nil, ErrNotContainDoneGroup
+	}
+	completed = dg.addTask()
+	dg.mu.Lock()
+	deadline = dg.waitDeadline
+	dg.mu.Unlock()
+	return deadline, !deadline.IsZero(), completed, nil
+}
+
+// Awaitable returns a function that guarantees execution of the process until it is called.
+// Note that if the timeout of WaitWithTimeout has passed (or the context of WaitWithContext has canceled), it will not wait.
+func Awaitable(ctx context.Context) (completed func()) {
+	return AwaitableWithKey(ctx, doneGroupKey)
+}
+
+// AwaitableWithKey returns a function that guarantees execution of the process until it is called.
 // Note that if the timeout of WaitWithTimeout has passed (or the context of WaitWithContext has canceled), it will not wait.
 func AwaitableWithKey(ctx context.Context, key any) (completed func()) {
 	completed, err := AwaiterWithKey(ctx, key)
@@ -242,7 +1245,45 @@ func AwaitableWithKey(ctx context.Context, key any) (completed func()) {
 	return completed
 }
 
+// AwaitableTracked returns a function that guarantees execution of the process until it is called like Awaitable, and a function that reports whether it was called before waiting gave up.
+// completedInTime returns false if completed has not been called yet, or if it was called after the timeout of WaitWithTimeout had passed (or the context of WaitWithContext had been canceled).
+func AwaitableTracked(ctx context.Context) (completed func(), completedInTime func() bool) {
+	return AwaitableTrackedWithKey(ctx, doneGroupKey)
+}
+
+// AwaitableTrackedWithKey returns a function that guarantees execution of the process until it is called like AwaitableWithKey, and a function that reports whether it was called before waiting gave up.
+// completedInTime returns false if completed has not been called yet, or if it was called after the timeout of WaitWithTimeoutAndKey had passed (or the context of WaitWithContextAndKey had been canceled).
+func AwaitableTrackedWithKey(ctx context.Context, key any) (completed func(), completedInTime func() bool) {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		panic(ErrNotContainDoneGroup)
+	}
+	done := dg.addTask()
+	var called, inTime atomic.Bool
+	return func() {
+		if called.CompareAndSwap(false, true) {
+			inTime.Store(dg.cleanupCtx.Err() == nil)
+			done()
+		}
+	}, inTime.Load
+}
+
+// AwaitableE returns a function that guarantees execution of the process until it is called.
+// Unlike Awaitable, it returns an error instead of panicking if the context does not contain a doneGroup (same as Awaiter).
+// Note that if the timeout of WaitWithTimeout has passed (or the context of WaitWithContext has canceled), it will not wait.
+func AwaitableE(ctx context.Context) (completed func(), err error) {
+	return AwaitableEWithKey(ctx, doneGroupKey)
+}
+
+// AwaitableEWithKey returns a function that guarantees execution of the process until it is called.
+// Unlike AwaitableWithKey, it returns an error instead of panicking if the context does not contain a doneGroup (same as AwaiterWithKey).
+// Note that if the timeout of WaitWithTimeout has passed (or the context of WaitWithContext has canceled), it will not wait.
+func AwaitableEWithKey(ctx context.Context, key any) (completed func(), err error) {
+	return AwaiterWithKey(ctx, key)
+}
+
 // Go calls the function now asynchronously.
+// It panics with ErrNilFunc if f is nil.
 // If an error occurs, it is stored in the doneGroup.
 // Note that if the timeout of WaitWithTimeout has passed (or the context of WaitWithContext has canceled), it will not wait.
 func Go(ctx context.Context, f func() error) {
@@ -250,45 +1291,1122 @@ func Go(ctx context.Context, f func() error) {
 }
 
 // GoWithKey calls the function now asynchronously.
+// It panics with ErrNilFunc if f is nil.
 // If an error occurs, it is stored in the doneGroup.
 // Note that if the timeout of WaitWithTimeout has passed (or the context of WaitWithContext has canceled), it will not wait.
 func GoWithKey(ctx context.Context, key any, f func() error) {
+	if f == nil {
+		panic(ErrNilFunc)
+	}
 	dg, ok := ctx.Value(key).(*doneGroup)
 	if !ok {
 		panic(ErrNotContainDoneGroup)
 	}
-	completed, err := AwaiterWithKey(ctx, key)
-	if err != nil {
-		panic(err)
+	dg.goFunc(func(_ func()) error {
+		return f()
+	})
+}
+
+// goFunc calls the function now asynchronously as a process of the doneGroup.
+// The function receives the function to mark the process as completed, which is also called when it returns.
+func (dg *doneGroup) goFunc(f func(completed func()) error) {
+	completed := dg.addTask()
+	var stack string
+	if dg.config.cancellerStack && (dg.config.cancelOnError || dg.config.deferredCancelDecider != nil) {
+		// The cancellation on error is attributed to the caller of Go
+		stack = callerStack()
 	}
+	dg.mu.Lock()
+	dg.goInflight++
+	dg.mu.Unlock()
 	go func() {
-		if err := f(); err != nil {
-			dg.mu.Lock()
-			dg.errors = errors.Join(dg.errors, err)
-			dg.mu.Unlock()
+		err := f(completed)
+		if err != nil && dg.config.goErrorFilter != nil {
+			err = dg.config.goErrorFilter(err)
+		}
+		if err != nil {
+			dg.appendError(err)
+			if dg.config.cancelOnError {
+				_ = dg.cancelWithCause(err, func() string { return stack })
+			}
+		}
+		decider := dg.config.deferredCancelDecider
+		var round []error
+		dg.mu.Lock()
+		if err != nil && decider != nil {
+			dg.goRoundErrors = append(dg.goRoundErrors, err)
+		}
+		dg.goInflight--
+		dg.goFinished++
+		if dg.goInflight == 0 {
+			// The Go set has drained
+			round, dg.goRoundErrors = dg.goRoundErrors, nil
+		}
+		for _, ch := range dg.goWatchers {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+		dg.mu.Unlock()
+		if len(round) > 0 && decider(round) {
+			_ = dg.cancelWithCause(errors.Join(round...), func() string { return stack })
 		}
 		completed()
 	}()
 }
 
-func withDoneGroup(ctx context.Context, cancelCause context.CancelCauseFunc, key any) context.Context {
-	wg := &sync.WaitGroup{}
+// GoRequired calls the function now asynchronously like Go, but the process is required to complete before Wait returns.
+// When the timeout of WaitWithTimeout has passed (or the context of WaitWithContext has canceled), the processes started by Go are abandoned,
+// but Wait keeps waiting for the required processes up to the hard limit set by WithRequiredGoLimit (without the limit, until they finish).
+// If they are still running at the hard limit, ErrRequiredGoUnfinished is joined to the error of Wait in addition to ErrWaitTimeout.
+// It is intended for the process that must finish (e.g. a final checkpoint write), while the cosmetic ones can be dropped.
+// The required processes are also counted by JoinGoWithProgress like the other processes.
+func GoRequired(ctx context.Context, f func() error) {
+	GoRequiredWithKey(ctx, doneGroupKey, f)
+}
+
+// GoRequiredWithKey calls the function now asynchronously like GoWithKey, but the process is required to complete before WaitWithKey returns.
+// When the timeout of WaitWithTimeoutAndKey has passed (or the context of WaitWithContextAndKey has canceled), the processes started by GoWithKey are abandoned,
+// but WaitWithKey keeps waiting for the required processes up to the hard limit set by WithRequiredGoLimit (without the limit, until they finish).
+// If they are still running at the hard limit, ErrRequiredGoUnfinished is joined to the error of WaitWithKey in addition to ErrWaitTimeout.
+// It is intended for the process that must finish (e.g. a final checkpoint write), while the cosmetic ones can be dropped.
+// The required processes are also counted by JoinGoWithProgressAndKey like the other processes.
+func GoRequiredWithKey(ctx context.Context, key any, f func() error) {
+	if f == nil {
+		panic(ErrNilFunc)
+	}
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		panic(ErrNotContainDoneGroup)
+	}
+	dg.mu.Lock()
+	if dg.requiredGo == 0 {
+		dg.requiredIdle = make(chan struct{})
+	}
+	dg.requiredGo++
+	dg.mu.Unlock()
+	GoWithKey(ctx, key, func() error {
+		defer func() {
+			dg.mu.Lock()
+			dg.requiredGo--
+			if dg.requiredGo == 0 {
+				close(dg.requiredIdle)
+			}
+			dg.mu.Unlock()
+		}()
+		return f()
+	})
+}
+
+// GoWithName calls the function with a name now asynchronously like Go.
+// If an error occurs, it is wrapped with the name (e.g. "worker-7: connection reset") and stored in the doneGroup.
+func GoWithName(ctx context.Context, name string, f func() error) {
+	GoWithNameAndKey(ctx, doneGroupKey, name, f)
+}
+
+// GoWithNameAndKey calls the function with a name now asynchronously like GoWithKey.
+// If an error occurs, it is wrapped with the name (e.g. "worker-7: connection reset") and stored in the doneGroup.
+func GoWithNameAndKey(ctx context.Context, key any, name string, f func() error) {
+	if f == nil {
+		panic(ErrNilFunc)
+	}
+	GoWithKey(ctx, key, func() error {
+		if err := f(); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return nil
+	})
+}
+
+// GoSync calls the function now asynchronously like Go, and returns after the goroutine has started executing the function.
+// It removes the window where the cancellation beats the start of the function (e.g. in tests).
+func GoSync(ctx context.Context, f func() error) {
+	GoSyncWithKey(ctx, doneGroupKey, f)
+}
+
+// GoSyncWithKey calls the function now asynchronously like GoWithKey, and returns after the goroutine has started executing the function.
+// It removes the window where the cancellation beats the start of the function (e.g. in tests).
+func GoSyncWithKey(ctx context.Context, key any, f func() error) {
+	if f == nil {
+		panic(ErrNilFunc)
+	}
+	started := make(chan struct{})
+	GoWithKey(ctx, key, func() error {
+		close(started)
+		return f()
+	})
+	<-started
+}
+
+// GoWithContext calls the function with the context now asynchronously like Go.
+// The function receives a context derived from ctx, so the values of ctx (e.g. correlation IDs and loggers) are visible and it is canceled with the doneGroup.
+// Pass the context to Recover so that the process is completed before Recover waits with WithRepanic.
+func GoWithContext(ctx context.Context, f func(ctx context.Context) error) {
+	GoWithContextAndKey(ctx, doneGroupKey, f)
+}
+
+// GoWithContextAndKey calls the function with the context now asynchronously like GoWithKey.
+// The function receives a context derived from ctx, so the values of ctx (e.g. correlation IDs and loggers) are visible and it is canceled with the doneGroup.
+// Pass the context to RecoverWithKey so that the process is completed before RecoverWithKey waits with WithRepanic.
+func GoWithContextAndKey(ctx context.Context, key any, f func(ctx context.Context) error) {
+	if f == nil {
+		panic(ErrNilFunc)
+	}
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		panic(ErrNotContainDoneGroup)
+	}
+	dg.goFunc(func(completed func()) error {
+		return f(context.WithValue(ctx, goTaskKey{}, completed))
+	})
+}
+
+// GoOrRun calls the function now asynchronously like Go if the context contains a doneGroup.
+// Otherwise, it calls the function in a plain goroutine and the error is discarded.
+// It returns true if the function is tied to the doneGroup. It panics with ErrNilFunc if f is nil.
+func GoOrRun(ctx context.Context, f func() error) bool {
+	return GoOrRunWithKey(ctx, doneGroupKey, f)
+}
+
+// GoOrRunWithKey calls the function now asynchronously like GoWithKey if the context contains a doneGroup.
+// Otherwise, it calls the function in a plain goroutine and the error is discarded.
+// It returns true if the function is tied to the doneGroup. It panics with ErrNilFunc if f is nil.
+func GoOrRunWithKey(ctx context.Context, key any, f func() error) bool {
+	if f == nil {
+		panic(ErrNilFunc)
+	}
+	if _, ok := ctx.Value(key).(*doneGroup); !ok {
+		go func() {
+			_ = f()
+		}()
+		return false
+	}
+	GoWithKey(ctx, key, f)
+	return true
+}
+
+// GoN calls n copies of the function now asynchronously like Go (e.g. a worker pool).
+// Each function receives the context and its index from 0 to n-1. The errors are stored in the doneGroup.
+func GoN(ctx context.Context, n int, f func(ctx context.Context, i int) error) {
+	GoNWithKey(ctx, doneGroupKey, n, f)
+}
+
+// GoNWithKey calls n copies of the function now asynchronously like GoWithKey (e.g. a worker pool).
+// Each function receives the context and its index from 0 to n-1. The errors are stored in the doneGroup.
+func GoNWithKey(ctx context.Context, key any, n int, f func(ctx context.Context, i int) error) {
+	if f == nil {
+		panic(ErrNilFunc)
+	}
+	for i := 0; i < n; i++ {
+		GoWithContextAndKey(ctx, key, func(ctx context.Context) error {
+			return f(ctx, i)
+		})
+	}
+}
+
+// JoinGoWithProgress blocks until the context is canceled. Then waits for the processes started by Go, reporting the progress.
+// progress is called with (0, total) first, and then each time a process finishes, serially from the calling goroutine.
+// total is the number of the processes running when the context is canceled (the processes of the descendant doneGroups are not included).
+// The errors of the processes are collected in the doneGroup and returned by Wait.
+func JoinGoWithProgress(ctx context.Context, progress func(done, total int)) error {
+	return JoinGoWithProgressAndKey(ctx, doneGroupKey, progress)
+}
+
+// JoinGoWithProgressAndKey blocks until the context is canceled. Then waits for the processes started by GoWithKey, reporting the progress.
+// progress is called with (0, total) first, and then each time a process finishes, serially from the calling goroutine.
+// total is the number of the processes running when the context is canceled (the processes of the descendant doneGroups are not included).
+// The errors of the processes are collected in the doneGroup and returned by WaitWithKey.
+func JoinGoWithProgressAndKey(ctx context.Context, key any, progress func(done, total int)) error {
 	dg, ok := ctx.Value(key).(*doneGroup)
 	if !ok {
-		// Root doneGroup
-		dg = &doneGroup{
-			cancel:        cancelCause,
-			cleanupGroups: []*sync.WaitGroup{wg},
+		return ErrNotContainDoneGroup
+	}
+	<-ctx.Done()
+	ch := make(chan struct{}, 1)
+	dg.mu.Lock()
+	total := dg.goInflight
+	base := dg.goFinished
+	dg.goWatchers = append(dg.goWatchers, ch)
+	dg.mu.Unlock()
+	defer func() {
+		dg.mu.Lock()
+		defer dg.mu.Unlock()
+		for i, w := range dg.goWatchers {
+			if w == ch {
+				dg.goWatchers = append(dg.goWatchers[:i], dg.goWatchers[i+1:]...)
+				break
+			}
+		}
+	}()
+	if progress != nil {
+		progress(0, total)
+	}
+	reported := 0
+	for {
+		dg.mu.Lock()
+		// The processes started after the cancellation may also finish, so cap at total
+		done := min(dg.goFinished-base, total)
+		inflight := dg.goInflight
+		dg.mu.Unlock()
+		for reported < done {
+			reported++
+			if progress != nil {
+				progress(reported, total)
+			}
 		}
-		return context.WithValue(ctx, key, dg)
+		if inflight == 0 {
+			return nil
+		}
+		<-ch
 	}
-	// Add cleanupGroup to parent doneGroup
-	dg.cleanupGroups = append(dg.cleanupGroups, wg)
+}
 
-	// Leaf doneGroup
-	leafDg := &doneGroup{
-		cancel:        cancelCause,
-		cleanupGroups: []*sync.WaitGroup{wg},
+// CollectedErrors returns the errors collected by the doneGroup so far (errors of Cleanup and Go).
+// It is useful to retrieve the errors of the cleanup functions that finish after Wait returns (e.g. registered with IgnoreWaitTimeout).
+// They are not collected if WithAbandonOnWaitTimeout is set. It returns nil if there are no errors.
+func CollectedErrors(ctx context.Context) ([]error, error) {
+	return CollectedErrorsWithKey(ctx, doneGroupKey)
+}
+
+// CollectedErrorsWithKey returns the errors collected by the doneGroup so far (errors of CleanupWithKey and GoWithKey).
+// It is useful to retrieve the errors of the cleanup functions that finish after WaitWithKey returns (e.g. registered with IgnoreWaitTimeout).
+// They are not collected if WithAbandonOnWaitTimeout is set. It returns nil if there are no errors.
+func CollectedErrorsWithKey(ctx context.Context, key any) ([]error, error) {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return nil, ErrNotContainDoneGroup
+	}
+	dg.mu.Lock()
+	defer dg.mu.Unlock()
+	if len(dg.errors) == 0 {
+		return nil, nil
+	}
+	return slices.Clone(dg.errors), nil
+}
+
+// FirstError returns a channel that receives the first error collected by the doneGroup (errors of Cleanup and Go).
+// If all the cleanup functions (and processes) finish without errors after the context is canceled, the channel is closed without a value.
+// It is safe not to receive from the channel.
+func FirstError(ctx context.Context) (<-chan error, error) {
+	return FirstErrorWithKey(ctx, doneGroupKey)
+}
+
+// FirstErrorWithKey returns a channel that receives the first error collected by the doneGroup (errors of Cleanup and Go).
+// If all the cleanup functions (and processes) finish without errors after the context is canceled, the channel is closed without a value.
+// It is safe not to receive from the channel.
+func FirstErrorWithKey(ctx context.Context, key any) (<-chan error, error) {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return nil, ErrNotContainDoneGroup
+	}
+	ch := make(chan error, 1)
+	dg.mu.Lock()
+	defer dg.mu.Unlock()
+	if dg.firstErr != nil {
+		ch <- dg.firstErr
+		close(ch)
+		return ch, nil
+	}
+	dg.firstErrChs = append(dg.firstErrChs, ch)
+	go func() {
+		<-dg.settledChan()
+		dg.mu.Lock()
+		defer dg.mu.Unlock()
+		for i, c := range dg.firstErrChs {
+			if c == ch {
+				close(ch)
+				dg.firstErrChs = append(dg.firstErrChs[:i], dg.firstErrChs[i+1:]...)
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// Settled returns a channel that is closed when the context is canceled and all the cleanup functions (and processes) finish.
+// Unlike ctx.Done(), which is closed at cancellation, it is closed after the cleanup. Successive calls return the same channel.
+// If the context does not contain a doneGroup, it returns nil (so it never settles).
+func Settled(ctx context.Context) <-chan struct{} {
+	return SettledWithKey(ctx, doneGroupKey)
+}
+
+// SettledWithKey returns a channel that is closed when the context is canceled and all the cleanup functions (and processes) finish.
+// Unlike ctx.Done(), which is closed at cancellation, it is closed after the cleanup. Successive calls return the same channel.
+// If the context does not contain a doneGroup, it returns nil (so it never settles).
+func SettledWithKey(ctx context.Context, key any) <-chan struct{} {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return nil
+	}
+	return dg.settledChan()
+}
+
+// FinalCause returns the cause of the shutdown of the context.
+// It returns context.Cause(ctx) unless WithCauseFromFirstCleanupError is set.
+// If it is set and the context was canceled without a cause (context.Canceled), it returns the first error returned by the cleanup functions instead.
+// Note that context.Cause(ctx) itself is immutable after the cancellation and is never changed.
+func FinalCause(ctx context.Context) error {
+	return FinalCauseWithKey(ctx, doneGroupKey)
+}
+
+// FinalCauseWithKey returns the cause of the shutdown of the context.
+// It returns context.Cause(ctx) unless WithCauseFromFirstCleanupError is set.
+// If it is set and the context was canceled without a cause (context.Canceled), it returns the first error returned by the cleanup functions instead.
+// Note that context.Cause(ctx) itself is immutable after the cancellation and is never changed.
+func FinalCauseWithKey(ctx context.Context, key any) error {
+	cause := context.Cause(ctx)
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok || !dg.config.causeFromFirstCleanupError || cause != context.Canceled {
+		return cause
+	}
+	dg.mu.Lock()
+	defer dg.mu.Unlock()
+	if dg.firstCleanupErr != nil {
+		return dg.firstCleanupErr
+	}
+	return cause
+}
+
+// ShuttingDownBudgetExceeded reports whether the waiting for the cleanup functions has already given up.
+// It is intended to be polled inside a running cleanup function to bail out early.
+// It returns true if the deadline of WaitWithTimeout (or WaitWithContext) has passed or the waiting context has been canceled.
+// It is best-effort: it returns false until Wait has started, and false for a Wait without timeout.
+func ShuttingDownBudgetExceeded(ctx context.Context) bool {
+	return ShuttingDownBudgetExceededWithKey(ctx, doneGroupKey)
+}
+
+// ShuttingDownBudgetExceededWithKey reports whether the waiting for the cleanup functions has already given up.
+// It is intended to be polled inside a running cleanup function to bail out early.
+// It returns true if the deadline of WaitWithTimeoutAndKey (or WaitWithContextAndKey) has passed or the waiting context has been canceled.
+// It is best-effort: it returns false until Wait has started, and false for a Wait without timeout.
+func ShuttingDownBudgetExceededWithKey(ctx context.Context, key any) bool {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return false
+	}
+	if dg.cleanupCtx.Err() != nil {
+		return true
+	}
+	dg.mu.Lock()
+	defer dg.mu.Unlock()
+	return !dg.waitDeadline.IsZero() && !time.Now().Before(dg.waitDeadline)
+}
+
+func withDoneGroup(parentCtx, ctx context.Context, cancelCause context.CancelCauseFunc, key any, opts []Option) context.Context {
+	wg := &cleanupGroup{}
+	cfg := &config{}
+	parent, ok := ctx.Value(key).(*doneGroup)
+	if ok {
+		// Inherit the configuration of parent doneGroup
+		*cfg = *parent.config
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	dg := &doneGroup{
+		cancel:        cancelCause,
+		cleanupGroups: []*cleanupGroup{wg},
+		parentCtx:     parentCtx,
+		config:        cfg,
+	}
+	dg.trackLeak()
+	if cfg.preCancelBarrier && cancelCause != nil {
+		dg.cancel = func(cause error) {
+			dg.preCancelOnce.Do(func() {
+				dg.runPreCancel()
+				cancelCause(cause)
+			})
+			cancelCause(cause)
+		}
+	}
+	if cancel := dg.cancel; cancel != nil {
+		dg.cancel = func(cause error) {
+			dg.markCanceledOwn()
+			cancel(cause)
+		}
+	}
+	if ok {
+		dg.parent = parent
+		dg.depth = parent.depth + 1
+		if cfg.maxDepth > 0 && dg.depth > cfg.maxDepth && !cfg.strictMaxDepth {
+			depthReport(fmt.Sprintf("donegroup: the doneGroup is nested %d deep, exceeding the max depth of %d (WithCancel may be applied to the same context repeatedly, e.g. by a middleware applied twice)", dg.depth, cfg.maxDepth))
+		}
+		parent.mu.Lock()
+		parent.children = append(parent.children, dg)
+		parent.mu.Unlock()
+		// Add cleanupGroup to ancestor doneGroups
+		for p := parent; p != nil; p = p.parent {
+			p.mu.Lock()
+			p.cleanupGroups = append(p.cleanupGroups, wg)
+			p.mu.Unlock()
+		}
+	}
+	if ctx.Err() != nil {
+		// The context is already done (e.g. the deadline has already passed),
+		// so start draining now so that every cleanup function starts immediately when registered.
+		dg.drain()
+	} else {
+		afterFunc := context.AfterFunc
+		if cfg.scheduler != nil {
+			afterFunc = cfg.scheduler
+		}
+		_ = afterFunc(ctx, dg.drain)
+	}
+	ctx = context.WithValue(ctx, key, dg)
+	if keys, _ := ctx.Value(doneGroupKeysKey{}).([]any); !slices.Contains(keys, key) {
+		ctx = context.WithValue(ctx, doneGroupKeysKey{}, append(slices.Clip(keys), key))
+	}
+	dg.ctx = ctx
+	dg.cleanupCtx, dg.cancelCleanup = context.WithCancelCause(context.WithoutCancel(ctx))
+	dg.cleanupCtx = context.WithValue(dg.cleanupCtx, cleanupCtxKey{}, dg)
+	return ctx
+}
+
+// runPreCancel calls the pre-cancel functions concurrently and waits for them.
+func (dg *doneGroup) runPreCancel() {
+	dg.mu.Lock()
+	fs := dg.preCancel
+	dg.preCancel = nil
+	dg.preCancelDone = true
+	rootWg := dg.cleanupGroups[0]
+	dg.mu.Unlock()
+	wg := &sync.WaitGroup{}
+	for _, f := range fs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer rootWg.Done()
+			if err := f(); err != nil {
+				dg.appendCleanupError(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// drain starts executing the registered cleanup functions.
+func (dg *doneGroup) drain() {
+	dg.leakCanceled()
+	dg.observeCanceled()
+	if dg.config.preCancelBarrier {
+		// The pre-cancel functions have not run yet if the context is canceled by the deadline or the parent
+		dg.preCancelOnce.Do(dg.runPreCancel)
+	}
+	if dg.config.leafFirst {
+		dg.mu.Lock()
+		descendants := slices.Clone(dg.cleanupGroups[1:])
+		dg.mu.Unlock()
+		if len(descendants) > 0 {
+			go func() {
+				// Start after the cleanup functions of the descendant doneGroups finish
+				for _, g := range descendants {
+					g.Wait()
+				}
+				dg.mu.Lock()
+				defer dg.mu.Unlock()
+				dg.draining = true
+				dg.runLocked()
+			}()
+			return
+		}
+	}
+	dg.mu.Lock()
+	defer dg.mu.Unlock()
+	dg.draining = true
+	dg.runLocked()
+}
+
+// runLocked starts workers for the pending cleanup functions. dg.mu must be held.
+func (dg *doneGroup) runLocked() {
+	for dg.config.maxConcurrentCleanups <= 0 || dg.running < dg.config.maxConcurrentCleanups {
+		i := dg.nextLocked()
+		if i < 0 {
+			return
+		}
+		dg.running++
+		c, deadline := dg.popLocked(i)
+		go dg.work(c, deadline)
+	}
+}
+
+// work executes the cleanup function, and then the pending cleanup functions until there are none left.
+func (dg *doneGroup) work(c *cleanup, deadline time.Time) {
+	rootWg := dg.cleanupGroups[0]
+	for {
+		start := time.Now()
+		dg.run(c, deadline)
+		elapsed := time.Since(start)
+		dg.mu.Lock()
+		dg.untrackLocked(c)
+		delete(dg.executing, c)
+		dg.pending--
+		dg.executed++
+		dg.finishedAt = time.Now()
+		if c.tag != "" {
+			dg.tags[c.tag].Pending--
+			dg.tags[c.tag].Duration += elapsed
+		}
+		if dg.phased {
+			dg.runningPhases[c.phase]--
+			if dg.runningPhases[c.phase] == 0 {
+				delete(dg.runningPhases, c.phase)
+			}
+		}
+		// Update the state before rootWg.Done so that it is consistent when Wait returns
+		i := dg.nextLocked()
+		last := i < 0
+		if last {
+			dg.running--
+		} else {
+			c, deadline = dg.popLocked(i)
+		}
+		if dg.phased {
+			// The next phase may become startable
+			dg.runLocked()
+		}
+		dg.mu.Unlock()
+		rootWg.Done()
+		if last {
+			return
+		}
+	}
+}
+
+// nextLocked returns the index of the next startable cleanup function, or -1 if there is none. dg.mu must be held.
+// The cleanup functions of a phase start after all the running cleanup functions of the lower phases finish.
+func (dg *doneGroup) nextLocked() int {
+	if len(dg.cleanups) == 0 {
+		return -1
+	}
+	if !dg.phased {
+		return 0
+	}
+	next := 0
+	for i, c := range dg.cleanups {
+		if c.phase < dg.cleanups[next].phase {
+			next = i
+		}
+	}
+	for p := range dg.runningPhases {
+		if p < dg.cleanups[next].phase {
+			return -1
+		}
+	}
+	return next
+}
+
+// popLocked pops the i-th pending cleanup function with the deadline of its budget. dg.mu must be held.
+// The deadline is zero unless WithBudgetSplitting is enabled and Wait has published its deadline.
+func (dg *doneGroup) popLocked(i int) (*cleanup, time.Time) {
+	c := dg.cleanups[i]
+	if i == 0 {
+		dg.cleanups = dg.cleanups[1:]
+	} else {
+		dg.cleanups = slices.Delete(dg.cleanups, i, i+1)
+	}
+	if dg.phased {
+		if dg.runningPhases == nil {
+			dg.runningPhases = make(map[Phase]int)
+		}
+		dg.runningPhases[c.phase]++
+	}
+	if dg.executing == nil {
+		dg.executing = make(map[*cleanup]struct{})
+	}
+	dg.executing[c] = struct{}{}
+	dg.trackLocked(c)
+	if !dg.config.budgetSplitting || dg.waitDeadline.IsZero() || c.ignoreWaitTimeout {
+		return c, time.Time{}
+	}
+	rounds := 1
+	if n := dg.config.maxConcurrentCleanups; n > 0 {
+		rounds = (len(dg.cleanups) + n) / n
+	}
+	return c, time.Now().Add(time.Until(dg.waitDeadline) / time.Duration(rounds))
+}
+
+// run executes the cleanup function and collects the error.
+func (dg *doneGroup) run(c *cleanup, deadline time.Time) {
+	err := dg.call(c, deadline)
+	if err != nil {
+		dg.appendCleanupError(err)
+		dg.mu.Lock()
+		dg.failures = append(dg.failures, cleanupFailure{name: c.name, err: err})
+		dg.mu.Unlock()
+	} else {
+		dg.mu.Lock()
+		dg.succeeded++
+		for _, ch := range dg.quorumWatchers {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+		dg.mu.Unlock()
+	}
+	c.finish(err)
+}
+
+// finish releases WaitForCleanup for the named cleanup function with its error.
+func (c *cleanup) finish(err error) {
+	if c.done != nil {
+		c.err = err
+		close(c.done)
+	}
+}
+
+// call executes the cleanup function with the context and the middlewares, and returns the filtered error.
+func (dg *doneGroup) call(c *cleanup, deadline time.Time) error {
+	ctx := dg.cleanupCtx
+	dg.mu.Lock()
+	base := dg.cleanupBase
+	dg.mu.Unlock()
+	if base != nil {
+		// Derive from the context of WaitWithCleanupContext, keeping the cancellation of dg.cleanupCtx
+		var cancel context.CancelCauseFunc
+		ctx, cancel = context.WithCancelCause(context.WithValue(base, cleanupCtxKey{}, dg))
+		defer cancel(nil)
+		stop := context.AfterFunc(dg.cleanupCtx, func() {
+			cancel(context.Cause(dg.cleanupCtx))
+		})
+		defer stop()
+	}
+	if c.ignoreWaitTimeout {
+		ctx = context.WithoutCancel(ctx)
+	}
+	if !deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+	timeout := c.timeout
+	if timeout == 0 {
+		timeout = dg.config.perCleanupTimeout
+	}
+	var exceeded error
+	if timeout > 0 {
+		exceeded = fmt.Errorf("donegroup: cleanup function exceeded its timeout of %s: %w", timeout, context.DeadlineExceeded)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout, exceeded)
+		defer cancel()
+	}
+	f := func() error {
+		err := c.f(ctx)
+		if exceeded == nil || context.Cause(ctx) != exceeded {
+			return err
+		}
+		// Record the timeout of the cleanup function without aborting the others
+		if err == nil || errors.Is(err, context.DeadlineExceeded) {
+			return exceeded
+		}
+		return fmt.Errorf("%w: %w", exceeded, err)
+	}
+	// The first middleware is the outermost
+	for i := len(dg.config.cleanupMiddlewares) - 1; i >= 0; i-- {
+		f = dg.config.cleanupMiddlewares[i](c.name, f)
+	}
+	err := f()
+	if err != nil && dg.config.cleanupErrorFilter != nil {
+		err = dg.config.cleanupErrorFilter(err)
+	}
+	return err
+}
+
+// setCleanupBase sets the context from which the contexts of the cleanup functions of the doneGroup and its descendants are derived.
+func (dg *doneGroup) setCleanupBase(ctxw context.Context) {
+	dg.mu.Lock()
+	dg.cleanupBase = ctxw
+	children := dg.children
+	dg.mu.Unlock()
+	for _, c := range children {
+		c.setCleanupBase(ctxw)
+	}
+}
+
+// setWaitDeadline publishes the deadline of the context (ctxw) of Wait to the doneGroup and its descendants.
+func (dg *doneGroup) setWaitDeadline(ctxw context.Context) {
+	d, ok := ctxw.Deadline()
+	if !ok {
+		return
+	}
+	dg.mu.Lock()
+	if dg.waitDeadline.IsZero() || d.Before(dg.waitDeadline) {
+		dg.waitDeadline = d
+	}
+	children := dg.children
+	dg.mu.Unlock()
+	for _, c := range children {
+		c.setWaitDeadline(ctxw)
+	}
+}
+
+// cancelCleanups cancels the contexts passed to the cleanup functions of the doneGroup and its descendants.
+func (dg *doneGroup) cancelCleanups(cause error) {
+	dg.cancelCleanup(cause)
+	dg.mu.Lock()
+	children := dg.children
+	dg.mu.Unlock()
+	for _, c := range children {
+		c.cancelCleanups(cause)
+	}
+}
+
+// waitRequiredGo waits for the processes started by GoRequired of the doneGroup and its descendants up to the hard limit of WithRequiredGoLimit.
+// It returns an error wrapping ErrRequiredGoUnfinished if they are still running at the hard limit.
+func (dg *doneGroup) waitRequiredGo() error {
+	var limit <-chan time.Time
+	if d := dg.config.requiredGoLimit; d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		limit = t.C
+	}
+	for _, idle := range dg.requiredIdleChans() {
+		select {
+		case <-idle:
+		case <-limit:
+			return fmt.Errorf("%w: %d still running", ErrRequiredGoUnfinished, dg.runningRequiredGo())
+		}
+	}
+	return nil
+}
+
+// requiredIdleChans returns the channels closed when the required processes of the doneGroup and its descendants finish.
+func (dg *doneGroup) requiredIdleChans() []chan struct{} {
+	var chans []chan struct{}
+	dg.mu.Lock()
+	if dg.requiredGo > 0 {
+		chans = append(chans, dg.requiredIdle)
+	}
+	children := dg.children
+	dg.mu.Unlock()
+	for _, c := range children {
+		chans = append(chans, c.requiredIdleChans()...)
+	}
+	return chans
+}
+
+// runningRequiredGo returns the number of the running required processes of the doneGroup and its descendants.
+func (dg *doneGroup) runningRequiredGo() int {
+	dg.mu.Lock()
+	n := dg.requiredGo
+	children := dg.children
+	dg.mu.Unlock()
+	for _, c := range children {
+		n += c.runningRequiredGo()
+	}
+	return n
+}
+
+// markCanceledOwn records that the context is canceled by its own cancel func, unless it is already canceled (e.g. by the parent).
+func (dg *doneGroup) markCanceledOwn() {
+	if dg.ctx.Err() == nil {
+		dg.canceledOwn.Store(true)
+	}
+}
+
+// observeCanceled records the time when the cancellation of the context is observed.
+// The drains of the doneGroups run in no fixed order, so the ancestors canceled by the cascade are recorded first to keep the times ordered.
+func (dg *doneGroup) observeCanceled() {
+	if p := dg.parent; p != nil && p.ctx.Err() != nil {
+		p.observeCanceled()
+	}
+	dg.canceledTime()
+}
+
+// canceledTime returns the time when the cancellation of the context was observed.
+func (dg *doneGroup) canceledTime() time.Time {
+	dg.mu.Lock()
+	defer dg.mu.Unlock()
+	if dg.canceledAt.IsZero() {
+		dg.canceledAt = time.Now()
+	}
+	return dg.canceledAt
+}
+
+// addTask adds a task to be waited for and returns a function to mark it as completed.
+func (dg *doneGroup) addTask() (completed func()) {
+	rootWg := dg.cleanupGroups[0]
+	var c *cleanup
+	if dg.config.registrationStacks {
+		c = dg.newCleanup(nil)
+	}
+	dg.mu.Lock()
+	rootWg.Add(1)
+	dg.tasks++
+	dg.trackLocked(c)
+	dg.mu.Unlock()
+	// Use atomic.Bool instead of sync.Once to reduce the bytes allocated per task (the number of allocations is the same)
+	var done atomic.Bool
+	return func() {
+		if done.CompareAndSwap(false, true) {
+			dg.mu.Lock()
+			dg.tasks--
+			dg.untrackLocked(c)
+			dg.mu.Unlock()
+			rootWg.Done()
+		}
+	}
+}
+
+// register registers the cleanup to be executed when the context is canceled.
+// It returns ErrLateRegistration if WithLateRegistrationCheck is enabled and the cleanup function is registered too late,
+// and ErrMaxDepthExceeded if WithStrictMaxDepth is enabled and the doneGroup is nested too deep.
+func (dg *doneGroup) register(c *cleanup) error {
+	rootWg := dg.cleanupGroups[0]
+	dg.mu.Lock()
+	defer dg.mu.Unlock()
+	if dg.unused {
+		return nil
+	}
+	var err error
+	// The cleanup function is not waited for if the wait has returned (or is returning because nothing is left)
+	if dg.config.lateRegistrationCheck && dg.draining && (dg.waitReturned || (dg.waiting > 0 && rootWg.n.Load() == 0)) {
+		err = ErrLateRegistration
+	}
+	if dg.config.strictMaxDepth && dg.config.maxDepth > 0 && dg.depth > dg.config.maxDepth {
+		err = errors.Join(err, ErrMaxDepthExceeded)
+	}
+	rootWg.Add(1)
+	dg.registered++
+	if c.done != nil {
+		if dg.named == nil {
+			dg.named = make(map[string][]*cleanup)
+		}
+		dg.named[c.name] = append(dg.named[c.name], c)
+	}
+	if c.phase != PhaseNormal {
+		dg.phased = true
+	}
+	dg.leakRegistered()
+	dg.registeredAt = append(dg.registeredAt, time.Now())
+	dg.pending++
+	if c.tag != "" {
+		if dg.tags == nil {
+			dg.tags = make(map[string]*TagStats)
+		}
+		ts, ok := dg.tags[c.tag]
+		if !ok {
+			ts = &TagStats{}
+			dg.tags[c.tag] = ts
+		}
+		ts.Cleanups++
+		ts.Pending++
+	}
+	dg.cleanups = append(dg.cleanups, c)
+	if dg.draining {
+		dg.runLocked()
+	}
+	return err
+}
+
+// newCleanup returns a cleanup for the function. It captures the stack trace if WithRegistrationStacks is enabled.
+func (dg *doneGroup) newCleanup(f func(ctx context.Context) error) *cleanup {
+	c := &cleanup{f: f}
+	if dg.config.registrationStacks {
+		c.stack = callerStack()
+	}
+	return c
+}
+
+// trackLocked records the cleanup as running if WithRegistrationStacks is enabled. dg.mu must be held.
+func (dg *doneGroup) trackLocked(c *cleanup) {
+	if !dg.config.registrationStacks {
+		return
+	}
+	if dg.inflight == nil {
+		dg.inflight = map[*cleanup]struct{}{}
+	}
+	dg.inflight[c] = struct{}{}
+}
+
+// untrackLocked removes the cleanup from the running cleanups. dg.mu must be held.
+func (dg *doneGroup) untrackLocked(c *cleanup) {
+	delete(dg.inflight, c)
+}
+
+// stillRunningErrors returns errors for the cleanup functions (and processes) of the doneGroup and its descendants that are still running.
+func (dg *doneGroup) stillRunningErrors() error {
+	var errs error
+	dg.mu.Lock()
+	for c := range dg.inflight {
+		if c.ignoreWaitTimeout {
+			continue
+		}
+		errs = errors.Join(errs, fmt.Errorf("donegroup: still running, registered at:\n%s", c.stack))
+	}
+	children := dg.children
+	dg.mu.Unlock()
+	for _, child := range children {
+		errs = errors.Join(errs, child.stillRunningErrors())
+	}
+	return errs
+}
+
+// activeGoroutines returns the number of the running workers of the cleanup functions and the running processes of the doneGroup and its descendants.
+func (dg *doneGroup) activeGoroutines() int {
+	dg.mu.Lock()
+	n := dg.running + dg.tasks
+	children := dg.children
+	dg.mu.Unlock()
+	for _, c := range children {
+		n += c.activeGoroutines()
+	}
+	return n
+}
+
+// runningCleanups returns the names of the running cleanup functions of the doneGroup and its descendants.
+func (dg *doneGroup) runningCleanups() []string {
+	dg.mu.Lock()
+	names := make([]string, 0, len(dg.executing))
+	for c := range dg.executing {
+		names = append(names, c.name)
+	}
+	children := dg.children
+	dg.mu.Unlock()
+	for _, c := range children {
+		names = append(names, c.runningCleanups()...)
+	}
+	return names
+}
+
+// pendingCleanups returns the number of the pending cleanup functions of the doneGroup and its descendants.
+func (dg *doneGroup) pendingCleanups() int {
+	dg.mu.Lock()
+	n := dg.pending
+	children := dg.children
+	dg.mu.Unlock()
+	for _, c := range children {
+		n += c.pendingCleanups()
+	}
+	return n
+}
+
+// settledChan returns a channel that is closed when the context is canceled and all the cleanup groups are done.
+func (dg *doneGroup) settledChan() <-chan struct{} {
+	dg.mu.Lock()
+	defer dg.mu.Unlock()
+	dg.leakConsumed()
+	if dg.settled == nil {
+		dg.settled = make(chan struct{})
+		go func() {
+			<-dg.ctx.Done()
+			<-dg.waitCleanupGroups()
+			close(dg.settled)
+		}()
+	}
+	return dg.settled
+}
+
+// idle reports whether all the cleanup groups have nothing to wait for.
+func (dg *doneGroup) idle() bool {
+	dg.mu.Lock()
+	defer dg.mu.Unlock()
+	for _, g := range dg.cleanupGroups {
+		if g.n.Load() != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// waitCleanupGroupsSync blocks until all the cleanup groups are done.
+// Fast path: the doneGroup without descendants waits for its cleanup group directly without waiter goroutines.
+func (dg *doneGroup) waitCleanupGroupsSync() {
+	dg.mu.Lock()
+	cleanupGroups := dg.cleanupGroups
+	dg.mu.Unlock()
+	if len(cleanupGroups) == 1 {
+		cleanupGroups[0].Wait()
+		return
+	}
+	<-dg.waitCleanupGroups()
+}
+
+// waitCleanupGroups returns a channel that is closed when all the cleanup groups are done.
+func (dg *doneGroup) waitCleanupGroups() <-chan struct{} {
+	dg.mu.Lock()
+	cleanupGroups := dg.cleanupGroups
+	dg.mu.Unlock()
+	if len(cleanupGroups) == 1 {
+		// Fast path: the doneGroup without descendants needs only one waiter goroutine
+		ch := make(chan struct{})
+		go func() {
+			cleanupGroups[0].Wait()
+			close(ch)
+		}()
+		return ch
+	}
+	wg := &sync.WaitGroup{}
+	for _, g := range cleanupGroups {
+		wg.Add(1)
+		go func() {
+			g.Wait()
+			wg.Done()
+		}()
+	}
+	ch := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(ch)
+	}()
+	return ch
+}
+
+// appendError collects the error into the doneGroup and its ancestors.
+func (dg *doneGroup) appendError(err error) {
+	for d := dg; d != nil; d = d.parent {
+		d.mu.Lock()
+		if d.abandoned {
+			d.mu.Unlock()
+			continue
+		}
+		if d == dg {
+			d.ownErrors = errors.Join(d.ownErrors, err)
+		}
+		d.appendErrorLocked(err)
+		d.mu.Unlock()
+	}
+}
+
+// appendCleanupError collects the error of the cleanup function into the doneGroup and its ancestors.
+func (dg *doneGroup) appendCleanupError(err error) {
+	for d := dg; d != nil; d = d.parent {
+		d.mu.Lock()
+		if d.abandoned {
+			d.mu.Unlock()
+			continue
+		}
+		if d == dg {
+			d.ownErrors = errors.Join(d.ownErrors, err)
+		}
+		d.appendErrorLocked(err)
+		if d.firstCleanupErr == nil {
+			d.firstCleanupErr = err
+		}
+		d.mu.Unlock()
+	}
+}
+
+// appendErrorLocked collects the error into the doneGroup. dg.mu must be held.
+func (dg *doneGroup) appendErrorLocked(err error) {
+	switch {
+	case dg.config.maxCollectedErrors <= 0 || dg.collected < dg.config.maxCollectedErrors:
+		dg.collected++
+		dg.errors = append(dg.errors, err)
+	case dg.elided == nil:
+		dg.elided = &elidedError{}
+		dg.elided.n.Add(1)
+		dg.errors = append(dg.errors, dg.elided)
+	default:
+		dg.elided.n.Add(1)
+	}
+	if dg.firstErr == nil {
+		dg.firstErr = err
+		for _, ch := range dg.firstErrChs {
+			ch <- err
+			close(ch)
+		}
+		dg.firstErrChs = nil
 	}
-	return context.WithValue(ctx, key, leafDg)
 }
@@ -3,6 +3,10 @@ package donegroup
 import (
 	"context"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -61,6 +65,367 @@ func TestCleanup(t *testing.T) {
 	})
 }
 
+func TestNestedCleanup(t *testing.T) {
+	t.Parallel()
+	errTest := errors.New("test error")
+	ctx, cancel := WithCancel(context.Background())
+	called := atomic.Int64{}
+	var register func(n int) func() error
+	register = func(n int) func() error {
+		return func() error {
+			time.Sleep(time.Millisecond)
+			called.Add(1)
+			if n == 0 {
+				return errTest
+			}
+			return Cleanup(ctx, register(n-1))
+		}
+	}
+	if err := Cleanup(ctx, register(5)); err != nil {
+		t.Fatal(err)
+	}
+	if err := CleanupWithContext(ctx, func(ctx context.Context) error {
+		return Cleanup(ctx, func() error {
+			called.Add(1)
+			return nil
+		})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := Wait(ctx); !errors.Is(err, errTest) {
+		t.Errorf("got %v, want %v", err, errTest)
+	}
+	if got := called.Load(); got != 7 {
+		t.Errorf("got %d, want %d", got, 7)
+	}
+}
+
+func TestCleanupOncePerContext(t *testing.T) {
+	t.Parallel()
+	t.Run("Register once per token", func(t *testing.T) {
+		ctx, cancel := WithCancel(context.Background())
+		called := atomic.Int64{}
+		token := struct{}{}
+		for i := 0; i < 3; i++ {
+			registered, err := CleanupOncePerContext(ctx, token, func() error {
+				called.Add(1)
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+			if want := i == 0; registered != want {
+				t.Errorf("got %v, want %v", registered, want)
+			}
+		}
+		registered, err := CleanupOncePerContext(ctx, "other", func() error {
+			called.Add(1)
+			return nil
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		if !registered {
+			t.Error("expected registered")
+		}
+		cancel()
+		if err := Wait(ctx); err != nil {
+			t.Error(err)
+		}
+		if got := called.Load(); got != 2 {
+			t.Errorf("got %d, want %d", got, 2)
+		}
+	})
+
+	t.Run("Scoped to the context", func(t *testing.T) {
+		rootCtx, rootCancel := WithCancel(context.Background())
+		leafCtx, _ := WithCancel(rootCtx)
+		for _, ctx := range []context.Context{rootCtx, leafCtx} {
+			registered, err := CleanupOncePerContext(ctx, "token", func() error {
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+			if !registered {
+				t.Error("expected registered")
+			}
+		}
+		rootCancel()
+		if err := Wait(rootCtx); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("CleanupOncePerContext without WithCancel", func(t *testing.T) {
+		registered, err := CleanupOncePerContext(context.Background(), "token", func() error {
+			return nil
+		})
+		if !errors.Is(err, ErrNotContainDoneGroup) {
+			t.Errorf("expected ErrNotContainDoneGroup, got %v", err)
+		}
+		if registered {
+			t.Error("expected not registered")
+		}
+	})
+}
+
+func TestCleanupEscalating(t *testing.T) {
+	t.Parallel()
+	var (
+		errGraceful = errors.New("graceful error")
+		errForceful = errors.New("forceful error")
+	)
+	t.Run("Graceful finishes in time", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := WithCancel(context.Background())
+		forced := atomic.Bool{}
+		if err := CleanupEscalating(ctx, 100*time.Millisecond, func() error {
+			return errGraceful
+		}, func() error {
+			forced.Store(true)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		err := Wait(ctx)
+		if !errors.Is(err, errGraceful) {
+			t.Errorf("got %v, want %v", err, errGraceful)
+		}
+		if errors.Is(err, ErrCleanupEscalated) {
+			t.Errorf("got %v, want not escalated", err)
+		}
+		if forced.Load() {
+			t.Error("forceful function called")
+		}
+	})
+
+	t.Run("Escalate to forceful", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := WithCancel(context.Background())
+		killed := make(chan struct{})
+		if err := CleanupEscalating(ctx, 5*time.Millisecond, func() error {
+			<-killed
+			return errGraceful
+		}, func() error {
+			close(killed)
+			return errForceful
+		}); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		err := Wait(ctx)
+		if !errors.Is(err, ErrCleanupEscalated) {
+			t.Errorf("got %v, want %v", err, ErrCleanupEscalated)
+		}
+		if !errors.Is(err, errForceful) {
+			t.Errorf("got %v, want %v", err, errForceful)
+		}
+	})
+
+	t.Run("CleanupEscalating without WithCancel", func(t *testing.T) {
+		t.Parallel()
+		err := CleanupEscalating(context.Background(), time.Second, func() error { return nil }, func() error { return nil })
+		if !errors.Is(err, ErrNotContainDoneGroup) {
+			t.Errorf("expected ErrNotContainDoneGroup, got %v", err)
+		}
+	})
+}
+
+func TestCleanupIf(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background())
+	var enabled, disabled atomic.Bool
+	enabled.Store(false)
+	disabled.Store(true)
+	var called []string
+	var mu sync.Mutex
+	for name, flag := range map[string]*atomic.Bool{"enabled": &enabled, "disabled": &disabled} {
+		if err := CleanupIf(ctx, flag.Load, func() error {
+			mu.Lock()
+			defer mu.Unlock()
+			called = append(called, name)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Toggle the conditions between the registration and the cancellation
+	enabled.Store(true)
+	disabled.Store(false)
+	cancel()
+	if err := Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(called) != 1 || called[0] != "enabled" {
+		t.Errorf("got %v, want [enabled]", called)
+	}
+	info, err := Inspect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Cleanups != 2 || info.Pending != 0 {
+		t.Errorf("got %+v, want 2 cleanups and 0 pending", *info)
+	}
+}
+
+func TestCleanupInPhase(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background())
+	var order []Phase
+	var mu sync.Mutex
+	errFirst := errors.New("first")
+	errLast := errors.New("last")
+	for _, phase := range []Phase{PhaseLast, PhaseNormal, PhaseFirst, PhaseNormal + 10, PhaseFirst} {
+		if err := CleanupInPhase(ctx, phase, func() error {
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, phase)
+			switch phase {
+			case PhaseFirst:
+				return errFirst
+			case PhaseLast:
+				return errLast
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cancel()
+	err := Wait(ctx)
+	if !errors.Is(err, errFirst) || !errors.Is(err, errLast) {
+		t.Errorf("got %v, want the errors of all phases", err)
+	}
+	want := []Phase{PhaseFirst, PhaseFirst, PhaseNormal, PhaseNormal + 10, PhaseLast}
+	if !slices.Equal(order, want) {
+		t.Errorf("got %v, want %v", order, want)
+	}
+}
+
+func TestWaitForCleanup(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background())
+	errFlush := errors.New("flush failed")
+	var flushed atomic.Bool
+	if err := CleanupWithName(ctx, "db-flush", func() error {
+		time.Sleep(10 * time.Millisecond)
+		flushed.Store(true)
+		return errFlush
+	}); err != nil {
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+	if err := Cleanup(ctx, func() error {
+		<-release
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := WaitForCleanup(ctx, "unknown"); !errors.Is(err, ErrCleanupNotFound) {
+		t.Errorf("got %v, want %v", err, ErrCleanupNotFound)
+	}
+	cancel()
+	// The other cleanup function is still running
+	if err := WaitForCleanup(ctx, "db-flush"); !errors.Is(err, errFlush) {
+		t.Errorf("got %v, want %v", err, errFlush)
+	}
+	if !flushed.Load() {
+		t.Error("cleanup function should have finished")
+	}
+	close(release)
+	if err := Wait(ctx); !errors.Is(err, errFlush) {
+		t.Errorf("got %v, want %v", err, errFlush)
+	}
+}
+
+func TestWaitForCleanupDiscarded(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background())
+	defer cancel()
+	if err := CleanupWithName(ctx, "db-flush", func() error {
+		return errors.New("should not be called")
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Discard(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := WaitForCleanup(ctx, "db-flush"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWaitWithAggregator(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background(), WithMaxConcurrentCleanups(1))
+	for _, msg := range []string{"a", "b", "c"} {
+		if err := Cleanup(ctx, func() error {
+			return errors.New(msg)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cancel()
+	summary := func(errs []error) error {
+		msgs := make([]string, 0, len(errs))
+		for _, err := range errs {
+			msgs = append(msgs, err.Error())
+		}
+		return fmt.Errorf("%d cleanup errors: %s", len(errs), strings.Join(msgs, ", "))
+	}
+	if got, want := WaitWithAggregator(ctx, summary).Error(), "3 cleanup errors: a, b, c"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// The aggregator applies only to the call
+	if got, want := Wait(ctx).Error(), "a\nb\nc"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	t.Run("no errors", func(t *testing.T) {
+		ctx, cancel := WithCancel(context.Background())
+		cancel()
+		if err := WaitWithAggregator(ctx, func([]error) error {
+			t.Error("aggregator should not be called")
+			return nil
+		}); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestCleanupOrSkip(t *testing.T) {
+	t.Parallel()
+	t.Run("CleanupOrSkip with WithCancel", func(t *testing.T) {
+		ctx, cancel := WithCancel(context.Background())
+		called := atomic.Bool{}
+		if !CleanupOrSkip(ctx, func() error {
+			called.Store(true)
+			return nil
+		}) {
+			t.Error("expected registered")
+		}
+		cancel()
+		if err := Wait(ctx); err != nil {
+			t.Error(err)
+		}
+		if !called.Load() {
+			t.Error("cleanup function not called")
+		}
+	})
+
+	t.Run("CleanupOrSkip without WithCancel", func(t *testing.T) {
+		if CleanupOrSkip(context.Background(), func() error {
+			return nil
+		}) {
+			t.Error("expected skipped")
+		}
+	})
+}
+
 func TestWait(t *testing.T) {
 	t.Parallel()
 	t.Run("Wait with WithCancel", func(t *testing.T) {
@@ -340,6 +705,47 @@ func TestRootWaitAll(t *testing.T) {
 	}()
 }
 
+func TestRootWaitCollectsTreeErrors(t *testing.T) {
+	t.Parallel()
+	var (
+		errLeaf       = errors.New("leaf error")
+		errGrandchild = errors.New("grandchild error")
+	)
+	rootCtx, rootCancel := WithCancel(context.Background())
+	leafCtx, _ := WithCancel(rootCtx)
+	grandchildCtx, _ := WithCancel(leafCtx)
+
+	if err := Cleanup(leafCtx, func() error {
+		return errLeaf
+	}); err != nil {
+		t.Fatal(err)
+	}
+	grandchildCleanup := atomic.Bool{}
+	if err := Cleanup(grandchildCtx, func() error {
+		time.Sleep(10 * time.Millisecond)
+		grandchildCleanup.Store(true)
+		return errGrandchild
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	rootCancel()
+	err := Wait(rootCtx)
+	if !errors.Is(err, errLeaf) {
+		t.Errorf("got %v, want %v", err, errLeaf)
+	}
+	if !errors.Is(err, errGrandchild) {
+		t.Errorf("got %v, want %v", err, errGrandchild)
+	}
+	if !grandchildCleanup.Load() {
+		t.Error("cleanup function for grandchild not finished")
+	}
+
+	if err := Wait(grandchildCtx); errors.Is(err, errLeaf) {
+		t.Errorf("got %v, want errors of the grandchild only", err)
+	}
+}
+
 func TestWaitWithTimeout(t *testing.T) {
 	t.Parallel()
 	ctx, cancel := WithCancel(context.Background())
@@ -364,6 +770,48 @@ func TestWaitWithTimeout(t *testing.T) {
 	}()
 }
 
+func TestWaitWithCleanupContext(t *testing.T) {
+	t.Parallel()
+	type key struct{}
+	ctx, cancel := WithCancel(context.WithValue(context.Background(), key{}, "original"))
+	got := make(chan any, 1)
+	hasDeadline := make(chan bool, 1)
+	if err := CleanupWithContext(ctx, func(ctx context.Context) error {
+		got <- ctx.Value(key{})
+		_, ok := ctx.Deadline()
+		hasDeadline <- ok
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	ctxw, cancelw := context.WithTimeout(context.WithValue(context.Background(), key{}, "shutdown"), time.Second)
+	defer cancelw()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- WaitWithCleanupContext(ctx, ctxw)
+	}()
+	for {
+		info, err := Inspect(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Waiting {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-errCh; err != nil {
+		t.Error(err)
+	}
+	if v := <-got; v != "shutdown" {
+		t.Errorf("got %v, want %v", v, "shutdown")
+	}
+	if !<-hasDeadline {
+		t.Error("the context of the cleanup function should have the deadline of ctxw")
+	}
+}
+
 func TestWaitWithContext(t *testing.T) {
 	t.Parallel()
 	ctx, cancel := WithCancel(context.Background())
@@ -390,65 +838,444 @@ func TestWaitWithContext(t *testing.T) {
 	}()
 }
 
-func TestAwaiter(t *testing.T) {
+func TestWaitWithTimeouts(t *testing.T) {
 	t.Parallel()
-	tests := []struct {
-		name     string
-		timeout  time.Duration
-		finished bool
-	}{
-		{
-			name:     "finished",
-			timeout:  100 * time.Millisecond,
-			finished: true,
-		},
-		{
-			name:     "not finished",
-			timeout:  5 * time.Millisecond,
-			finished: false,
-		},
+	ctx, cancel := WithCancel(context.Background())
+	stopped := atomic.Bool{}
+	if err := CleanupWithContext(ctx, func(ctx context.Context) error {
+		// Stop cooperatively at the soft timeout
+		<-ctx.Done()
+		stopped.Store(true)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
 	}
-	for _, tt := range tests {
-		tt := tt
-		t.Run(tt.name, func(t *testing.T) {
-			t.Parallel()
-			ctx, cancel := WithCancel(context.Background())
-
-			var finished int32
+	if err := Cleanup(ctx, func() error {
+		// Ignore the soft timeout
+		time.Sleep(200 * time.Millisecond)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	err := WaitWithTimeouts(ctx, 10*time.Millisecond, 50*time.Millisecond)
+	if !errors.Is(err, ErrWaitTimeout) {
+		t.Errorf("got %v, want %v", err, ErrWaitTimeout)
+	}
+	if !strings.Contains(err.Error(), "1 cleanup functions ignored the soft timeout") {
+		t.Errorf("got %v, want the error reporting the cleanup functions ignoring the soft timeout", err)
+	}
+	if !stopped.Load() {
+		t.Error("cleanup function should be stopped at the soft timeout")
+	}
+}
 
-			go func() {
-				completed, err := Awaiter(ctx)
-				if err != nil {
-					t.Error(err)
-				}
-				<-ctx.Done()
-				time.Sleep(20 * time.Millisecond)
-				atomic.AddInt32(&finished, 1)
-				completed()
-			}()
+func TestCloser(t *testing.T) {
+	t.Parallel()
+	parent, cancel := WithCancel(context.Background())
+	child, _ := WithCancel(parent)
+	errTest := errors.New("child cleanup failed")
+	if err := Cleanup(child, func() error {
+		return errTest
+	}); err != nil {
+		t.Fatal(err)
+	}
+	closer := Closer(child)
+	if err := Cleanup(parent, closer.Close); err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(closer.Close(), errTest) {
+		t.Errorf("got %v, want %v", closer.Close(), errTest)
+	}
+	if child.Err() == nil {
+		t.Error("child context should be canceled")
+	}
+	cancel()
+	if err := Wait(parent); !errors.Is(err, errTest) {
+		t.Errorf("got %v, want %v", err, errTest)
+	}
+}
 
-			defer func() {
-				cancel()
-				time.Sleep(10 * time.Millisecond)
-				err := WaitWithTimeout(ctx, tt.timeout)
-				if tt.finished != (atomic.LoadInt32(&finished) > 0) {
-					t.Errorf("expected finished: %v, got: %v", tt.finished, finished)
-				}
-				if tt.finished {
-					if err != nil {
-						t.Error(err)
-					}
-					return
-				}
+func TestWaitAndCancel(t *testing.T) {
+	t.Parallel()
+	t.Run("Cancel and wait", func(t *testing.T) {
+		t.Parallel()
+		ctx, _ := WithCancel(context.Background())
+		cleanup := atomic.Bool{}
+		if err := Cleanup(ctx, func() error {
+			cleanup.Store(true)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := WaitAndCancel(ctx); err != nil {
+			t.Error(err)
+		}
+		if !cleanup.Load() {
+			t.Error("cleanup function not called")
+		}
+		if !errors.Is(context.Cause(ctx), context.Canceled) {
+			t.Errorf("got %v, want %v", context.Cause(ctx), context.Canceled)
+		}
+	})
+
+	t.Run("Already canceled with cause", func(t *testing.T) {
+		t.Parallel()
+		errTest := errors.New("test error")
+		ctx, cancel := WithCancelCause(context.Background())
+		cancel(errTest)
+		if err := WaitAndCancel(ctx); err != nil {
+			t.Error(err)
+		}
+		if !errors.Is(context.Cause(ctx), errTest) {
+			t.Errorf("got %v, want %v", context.Cause(ctx), errTest)
+		}
+	})
+
+	t.Run("WaitAndCancel without WithCancel", func(t *testing.T) {
+		t.Parallel()
+		if err := WaitAndCancel(context.Background()); !errors.Is(err, ErrNotContainDoneGroup) {
+			t.Errorf("expected ErrNotContainDoneGroup, got %v", err)
+		}
+	})
+}
+
+func TestWaitWithGrace(t *testing.T) {
+	t.Parallel()
+	t.Run("Wait for the grace period", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := WithCancel(context.Background())
+		if err := Cleanup(ctx, func() error {
+			return nil
+		}); err != nil {
+			t.Error(err)
+		}
+		cancel()
+		minGrace := 50 * time.Millisecond
+		start := time.Now()
+		if err := WaitWithGrace(ctx, minGrace, time.Second); err != nil {
+			t.Error(err)
+		}
+		if elapsed := time.Since(start); elapsed < minGrace-5*time.Millisecond {
+			t.Errorf("returned before the grace period: %v", elapsed)
+		}
+	})
+
+	t.Run("Grace period has already elapsed", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := WithCancel(context.Background())
+		if err := Cleanup(ctx, func() error {
+			time.Sleep(30 * time.Millisecond)
+			return nil
+		}); err != nil {
+			t.Error(err)
+		}
+		cancel()
+		start := time.Now()
+		if err := WaitWithGrace(ctx, 10*time.Millisecond, time.Second); err != nil {
+			t.Error(err)
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("waited too long: %v", elapsed)
+		}
+	})
+
+	t.Run("Timeout is the upper bound", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := WithCancel(context.Background())
+		if err := Cleanup(ctx, func() error {
+			time.Sleep(100 * time.Millisecond)
+			return nil
+		}); err != nil {
+			t.Error(err)
+		}
+		cancel()
+		start := time.Now()
+		if err := WaitWithGrace(ctx, time.Second, 10*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected timeout error: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("waited too long: %v", elapsed)
+		}
+	})
+
+	t.Run("Timeout cuts the grace period", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := WithCancel(context.Background())
+		if err := Cleanup(ctx, func() error {
+			return nil
+		}); err != nil {
+			t.Error(err)
+		}
+		cancel()
+		if err := WaitWithGrace(ctx, time.Second, 10*time.Millisecond); !errors.Is(err, ErrWaitTimeout) {
+			t.Errorf("got %v, want %v", err, ErrWaitTimeout)
+		}
+	})
+
+	t.Run("WaitWithGrace without WithCancel", func(t *testing.T) {
+		t.Parallel()
+		if err := WaitWithGrace(context.Background(), time.Second, time.Second); !errors.Is(err, ErrNotContainDoneGroup) {
+			t.Errorf("expected ErrNotContainDoneGroup, got %v", err)
+		}
+	})
+}
+
+func TestCleanupWithContext(t *testing.T) {
+	t.Parallel()
+	t.Run("Canceled when the wait context is canceled", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := WithCancel(context.Background())
+		leafCtx, _ := WithCancel(ctx)
+		canceled := make(chan error, 2)
+		for _, c := range []context.Context{ctx, leafCtx} {
+			if err := CleanupWithContext(c, func(ctx context.Context) error {
+				<-ctx.Done()
+				canceled <- context.Cause(ctx)
+				return nil
+			}); err != nil {
+				t.Error(err)
+			}
+		}
+		cancel()
+		ctxw, cancelw := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		defer cancelw()
+		if err := WaitWithContext(ctx, ctxw); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected timeout error: %v", err)
+		}
+		for i := 0; i < 2; i++ {
+			select {
+			case err := <-canceled:
 				if !errors.Is(err, context.DeadlineExceeded) {
-					t.Errorf("expected timeout error: %v", err)
+					t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
 				}
-			}()
+			case <-time.After(time.Second):
+				t.Fatal("cleanup context not canceled")
+			}
+		}
+	})
+
+	t.Run("Not canceled when finished in time", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := WithCancel(context.Background())
+		if err := CleanupWithContext(ctx, func(ctx context.Context) error {
+			return ctx.Err()
+		}); err != nil {
+			t.Error(err)
+		}
+		cancel()
+		if err := WaitWithTimeout(ctx, time.Second); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("Keeps the values of the original context", func(t *testing.T) {
+		t.Parallel()
+		type traceIDKey struct{}
+		ctx := context.WithValue(context.Background(), traceIDKey{}, "trace-1")
+		ctx, cancel := WithCancel(ctx, WithBudgetSplitting())
+		leafCtx, _ := WithCancel(ctx)
+		got := make(chan any, 2)
+		for _, c := range []context.Context{ctx, leafCtx} {
+			if err := CleanupWithContext(c, func(ctx context.Context) error {
+				got <- ctx.Value(traceIDKey{})
+				return nil
+			}); err != nil {
+				t.Error(err)
+			}
+		}
+		cancel()
+		if err := WaitWithTimeout(ctx, time.Second); err != nil {
+			t.Error(err)
+		}
+		for i := 0; i < 2; i++ {
+			if v := <-got; v != "trace-1" {
+				t.Errorf("got %v, want %v", v, "trace-1")
+			}
+		}
+	})
+
+	t.Run("CleanupWithContext without WithCancel", func(t *testing.T) {
+		t.Parallel()
+		err := CleanupWithContext(context.Background(), func(ctx context.Context) error {
+			return nil
 		})
+		if !errors.Is(err, ErrNotContainDoneGroup) {
+			t.Errorf("expected ErrNotContainDoneGroup, got %v", err)
+		}
+	})
+}
+
+func TestWaitInCleanup(t *testing.T) {
+	t.Parallel()
+	t.Run("Drive the shutdown of the owned child", func(t *testing.T) {
+		t.Parallel()
+		errChild := errors.New("child error")
+		ctx, cancel := WithCancel(context.Background())
+		nestedCtx, _ := WithCancel(ctx)
+		ownedCtx, cancelOwned := WithCancel(context.Background())
+		for _, c := range []context.Context{nestedCtx, ownedCtx} {
+			if err := Cleanup(c, func() error {
+				time.Sleep(10 * time.Millisecond)
+				return errChild
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := CleanupWithContext(ctx, func(_ context.Context) error {
+			cancelOwned()
+			return errors.Join(Wait(nestedCtx), Wait(ownedCtx))
+		}); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		err := WaitWithTimeout(ctx, time.Second)
+		if !errors.Is(err, errChild) {
+			t.Errorf("got %v, want %v", err, errChild)
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got %v, want no timeout", err)
+		}
+	})
+
+	t.Run("Wait for own doneGroup", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := WithCancel(context.Background())
+		leafCtx, _ := WithCancel(ctx)
+		for _, c := range []context.Context{ctx, leafCtx} {
+			if err := CleanupWithContext(c, func(ctx context.Context) error {
+				return Wait(ctx)
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		cancel()
+		err := WaitWithTimeout(ctx, time.Second)
+		if !errors.Is(err, ErrWaitInCleanup) {
+			t.Errorf("got %v, want %v", err, ErrWaitInCleanup)
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got %v, want no timeout", err)
+		}
+	})
+}
+
+func TestCleanupContext(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background())
+	stuck := make(chan struct{})
+	abortStuck, err := CleanupContext(ctx, func(ctx context.Context) error {
+		close(stuck)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	siblingDone := make(chan error, 1)
+	abortSibling, err := CleanupContext(ctx, func(ctx context.Context) error {
+		<-stuck
+		time.Sleep(10 * time.Millisecond)
+		siblingDone <- ctx.Err()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	<-stuck
+	// Abort only the stuck cleanup function
+	abortStuck()
+	err = Wait(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+	if err := <-siblingDone; err != nil {
+		t.Errorf("the sibling context should not be canceled: %v", err)
+	}
+	// Canceling after the cleanup function finished is a no-op
+	abortSibling()
+	abortStuck()
+
+	if _, err := CleanupContext(context.Background(), func(ctx context.Context) error { return nil }); !errors.Is(err, ErrNotContainDoneGroup) {
+		t.Errorf("got %v, want %v", err, ErrNotContainDoneGroup)
 	}
 }
 
-func TestAwaitable(t *testing.T) {
+func TestWaitKeysInOrder(t *testing.T) {
+	t.Parallel()
+	var (
+		errNetwork = errors.New("network error")
+		errStorage = errors.New("storage error")
+	)
+	ctx, cancelNetwork := WithCancelWithKey(context.Background(), "network")
+	ctx, cancelStorage := WithCancelWithKey(ctx, "storage")
+	if err := CleanupWithKey(ctx, "network", func() error {
+		return errNetwork
+	}); err != nil {
+		t.Fatal(err)
+	}
+	storageCleanup := atomic.Bool{}
+	if err := CleanupWithKey(ctx, "storage", func() error {
+		storageCleanup.Store(true)
+		return errStorage
+	}); err != nil {
+		t.Fatal(err)
+	}
+	cancelNetwork()
+	cancelStorage()
+	err := WaitKeysInOrder(ctx, "network", "missing", "storage")
+	if !errors.Is(err, errNetwork) {
+		t.Errorf("got %v, want %v", err, errNetwork)
+	}
+	if !errors.Is(err, errStorage) {
+		t.Errorf("got %v, want %v", err, errStorage)
+	}
+	if !errors.Is(err, ErrNotContainDoneGroup) {
+		t.Errorf("got %v, want %v", err, ErrNotContainDoneGroup)
+	}
+	if !storageCleanup.Load() {
+		t.Error("cleanup function for storage not called")
+	}
+}
+
+func TestAwaiterWithDeadline(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background())
+	_, ok, completed, err := AwaiterWithDeadline(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("deadline should be unknown before Wait begins")
+	}
+	cancel()
+	start := time.Now()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- WaitWithTimeout(ctx, time.Second)
+	}()
+	for {
+		deadline, ok, done, err := AwaiterWithDeadline(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		done()
+		if ok {
+			if deadline.Before(start) || deadline.After(time.Now().Add(time.Second)) {
+				t.Errorf("got %v, want the deadline of the wait", deadline)
+			}
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	completed()
+	if err := <-errCh; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAwaiter(t *testing.T) {
 	t.Parallel()
 	tests := []struct {
 		name     string
@@ -475,10 +1302,14 @@ func TestAwaitable(t *testing.T) {
 			var finished int32
 
 			go func() {
-				defer Awaitable(ctx)()
+				completed, err := Awaiter(ctx)
+				if err != nil {
+					t.Error(err)
+				}
 				<-ctx.Done()
 				time.Sleep(20 * time.Millisecond)
 				atomic.AddInt32(&finished, 1)
+				completed()
 			}()
 
 			defer func() {
@@ -502,29 +1333,7 @@ func TestAwaitable(t *testing.T) {
 	}
 }
 
-func TestCancel(t *testing.T) {
-	t.Parallel()
-	t.Run("Cancel with WithCancel", func(t *testing.T) {
-		ctx, _ := WithCancel(context.Background())
-		err := Cancel(ctx)
-		if err != nil {
-			t.Error(err)
-		}
-		if !errors.Is(ctx.Err(), context.Canceled) {
-			t.Error("expected context.Canceled")
-		}
-	})
-
-	t.Run("Cancel without WithCancel", func(t *testing.T) {
-		ctx := context.Background()
-		err := Cancel(ctx)
-		if err == nil {
-			t.Error("expected error, got nil")
-		}
-	})
-}
-
-func TestGo(t *testing.T) {
+func TestAwaitable(t *testing.T) {
 	t.Parallel()
 	tests := []struct {
 		name     string
@@ -533,7 +1342,7 @@ func TestGo(t *testing.T) {
 	}{
 		{
 			name:     "finished",
-			timeout:  200 * time.Millisecond,
+			timeout:  100 * time.Millisecond,
 			finished: true,
 		},
 		{
@@ -550,12 +1359,12 @@ func TestGo(t *testing.T) {
 
 			var finished int32
 
-			Go(ctx, func() error {
+			go func() {
+				defer Awaitable(ctx)()
 				<-ctx.Done()
-				time.Sleep(100 * time.Millisecond)
+				time.Sleep(20 * time.Millisecond)
 				atomic.AddInt32(&finished, 1)
-				return nil
-			})
+			}()
 
 			defer func() {
 				cancel()
@@ -578,25 +1387,743 @@ func TestGo(t *testing.T) {
 	}
 }
 
-func TestGoWithError(t *testing.T) {
+func TestAwaitableTracked(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background())
+	fastCompleted, fastInTime := AwaitableTracked(ctx)
+	slowCompleted, slowInTime := AwaitableTracked(ctx)
+	go func() {
+		<-ctx.Done()
+		fastCompleted()
+	}()
+	cancel()
+	if err := WaitWithTimeout(ctx, 20*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if slowInTime() {
+		t.Error("got true before completed is called")
+	}
+	slowCompleted()
+	if !fastInTime() {
+		t.Error("the fast process should be completed in time")
+	}
+	if slowInTime() {
+		t.Error("the slow process should not be completed in time")
+	}
+}
+
+func TestAwaitableE(t *testing.T) {
+	t.Parallel()
+	t.Run("AwaitableE with WithCancel", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := WithCancel(context.Background())
+		var finished atomic.Bool
+		go func() {
+			completed, err := AwaitableE(ctx)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer completed()
+			<-ctx.Done()
+			time.Sleep(10 * time.Millisecond)
+			finished.Store(true)
+		}()
+		time.Sleep(5 * time.Millisecond)
+		cancel()
+		if err := WaitWithTimeout(ctx, time.Second); err != nil {
+			t.Error(err)
+		}
+		if !finished.Load() {
+			t.Error("expected finished")
+		}
+	})
+
+	t.Run("AwaitableE without WithCancel", func(t *testing.T) {
+		t.Parallel()
+		completed, err := AwaitableE(context.Background())
+		if !errors.Is(err, ErrNotContainDoneGroup) {
+			t.Errorf("expected ErrNotContainDoneGroup, got %v", err)
+		}
+		if completed != nil {
+			t.Error("expected nil")
+		}
+	})
+}
+
+func TestCancel(t *testing.T) {
+	t.Parallel()
+	t.Run("Cancel with WithCancel", func(t *testing.T) {
+		ctx, _ := WithCancel(context.Background())
+		err := Cancel(ctx)
+		if err != nil {
+			t.Error(err)
+		}
+		if !errors.Is(ctx.Err(), context.Canceled) {
+			t.Error("expected context.Canceled")
+		}
+	})
+
+	t.Run("Cancel without WithCancel", func(t *testing.T) {
+		ctx := context.Background()
+		err := Cancel(ctx)
+		if err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+}
+
+func TestDiscard(t *testing.T) {
+	t.Parallel()
+	t.Run("Discard cleanups", func(t *testing.T) {
+		ctx, cancel := WithCancel(context.Background())
+		called := atomic.Bool{}
+		for i := 0; i < 3; i++ {
+			if err := Cleanup(ctx, func() error {
+				called.Store(true)
+				return errors.New("test error")
+			}); err != nil {
+				t.Error(err)
+			}
+		}
+		if err := CleanupTagged(ctx, "db-conn", func() error {
+			called.Store(true)
+			return nil
+		}); err != nil {
+			t.Error(err)
+		}
+		if err := Discard(ctx); err != nil {
+			t.Error(err)
+		}
+		tags, err := Tags(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := tags["db-conn"], (TagStats{Cleanups: 1, Pending: 0}); got != want {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+		cancel()
+		if err := Wait(ctx); err != nil {
+			t.Error(err)
+		}
+		if called.Load() {
+			t.Error("cleanup function called")
+		}
+	})
+
+	t.Run("Discard queued cleanups while draining", func(t *testing.T) {
+		ctx, cancel := WithCancel(context.Background(), WithMaxConcurrentCleanups(1))
+		started := make(chan struct{})
+		release := make(chan struct{})
+		called := atomic.Int64{}
+		if err := Cleanup(ctx, func() error {
+			close(started)
+			<-release
+			called.Add(1)
+			return nil
+		}); err != nil {
+			t.Error(err)
+		}
+		if err := Cleanup(ctx, func() error {
+			called.Add(1)
+			return nil
+		}); err != nil {
+			t.Error(err)
+		}
+		cancel()
+		<-started
+		if err := Discard(ctx); err != nil {
+			t.Error(err)
+		}
+		close(release)
+		if err := Wait(ctx); err != nil {
+			t.Error(err)
+		}
+		if got := called.Load(); got != 1 {
+			t.Errorf("got %d, want %d", got, 1)
+		}
+	})
+
+	t.Run("Cleanup after Discard", func(t *testing.T) {
+		ctx, cancel := WithCancel(context.Background())
+		if err := Discard(ctx); err != nil {
+			t.Error(err)
+		}
+		called := atomic.Bool{}
+		if err := Cleanup(ctx, func() error {
+			called.Store(true)
+			return nil
+		}); err != nil {
+			t.Error(err)
+		}
+		cancel()
+		if err := Wait(ctx); err != nil {
+			t.Error(err)
+		}
+		if !called.Load() {
+			t.Error("cleanup function not called")
+		}
+	})
+
+	t.Run("Discard without WithCancel", func(t *testing.T) {
+		if err := Discard(context.Background()); !errors.Is(err, ErrNotContainDoneGroup) {
+			t.Errorf("expected ErrNotContainDoneGroup, got %v", err)
+		}
+	})
+}
+
+func TestMarkUnused(t *testing.T) {
+	t.Parallel()
+	t.Run("Nothing to clean up", func(t *testing.T) {
+		ctx, cancel := WithCancel(context.Background())
+		if err := MarkUnused(ctx); err != nil {
+			t.Error(err)
+		}
+		called := atomic.Bool{}
+		if err := Cleanup(ctx, func() error {
+			called.Store(true)
+			return nil
+		}); err != nil {
+			t.Error(err)
+		}
+		if err := Wait(ctx); err != nil {
+			t.Error(err)
+		}
+		cancel()
+		time.Sleep(5 * time.Millisecond)
+		if called.Load() {
+			t.Error("cleanup function called")
+		}
+	})
+
+	t.Run("Cleanups have been registered", func(t *testing.T) {
+		ctx, cancel := WithCancel(context.Background())
+		called := atomic.Bool{}
+		if err := Cleanup(ctx, func() error {
+			called.Store(true)
+			return nil
+		}); err != nil {
+			t.Error(err)
+		}
+		if err := MarkUnused(ctx); !errors.Is(err, ErrCleanupRegistered) {
+			t.Errorf("got %v, want %v", err, ErrCleanupRegistered)
+		}
+		cancel()
+		if err := Wait(ctx); err != nil {
+			t.Error(err)
+		}
+		if called.Load() {
+			t.Error("cleanup function called")
+		}
+	})
+
+	t.Run("MarkUnused without WithCancel", func(t *testing.T) {
+		if err := MarkUnused(context.Background()); !errors.Is(err, ErrNotContainDoneGroup) {
+			t.Errorf("expected ErrNotContainDoneGroup, got %v", err)
+		}
+	})
+}
+
+func TestGo(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		timeout  time.Duration
+		finished bool
+	}{
+		{
+			name:     "finished",
+			timeout:  200 * time.Millisecond,
+			finished: true,
+		},
+		{
+			name:     "not finished",
+			timeout:  5 * time.Millisecond,
+			finished: false,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := WithCancel(context.Background())
+
+			var finished int32
+
+			Go(ctx, func() error {
+				<-ctx.Done()
+				time.Sleep(100 * time.Millisecond)
+				atomic.AddInt32(&finished, 1)
+				return nil
+			})
+
+			defer func() {
+				cancel()
+				time.Sleep(10 * time.Millisecond)
+				err := WaitWithTimeout(ctx, tt.timeout)
+				if tt.finished != (atomic.LoadInt32(&finished) > 0) {
+					t.Errorf("expected finished: %v, got: %v", tt.finished, finished)
+				}
+				if tt.finished {
+					if err != nil {
+						t.Error(err)
+					}
+					return
+				}
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("expected timeout error: %v", err)
+				}
+			}()
+		})
+	}
+}
+
+func TestGoOrRun(t *testing.T) {
+	t.Parallel()
+	t.Run("GoOrRun with WithCancel", func(t *testing.T) {
+		errTest := errors.New("test error")
+		ctx, cancel := WithCancel(context.Background())
+		if !GoOrRun(ctx, func() error {
+			return errTest
+		}) {
+			t.Error("expected tied to the doneGroup")
+		}
+		cancel()
+		if err := Wait(ctx); !errors.Is(err, errTest) {
+			t.Errorf("got %v, want %v", err, errTest)
+		}
+	})
+
+	t.Run("GoOrRun without WithCancel", func(t *testing.T) {
+		done := make(chan struct{})
+		if GoOrRun(context.Background(), func() error {
+			close(done)
+			return nil
+		}) {
+			t.Error("expected not tied to the doneGroup")
+		}
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Error("function not called")
+		}
+	})
+}
+
+func TestGoN(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background())
+	errTest := errors.New("test error")
+	var called [5]atomic.Bool
+	GoN(ctx, len(called), func(ctx context.Context, i int) error {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		called[i].Store(true)
+		if i == 3 {
+			return errTest
+		}
+		return nil
+	})
+	cancel()
+	if err := Wait(ctx); !errors.Is(err, errTest) {
+		t.Errorf("got %v, want %v", err, errTest)
+	}
+	for i := range called {
+		if !called[i].Load() {
+			t.Errorf("worker %d not waited", i)
+		}
+	}
+}
+
+func TestJoinGoWithProgress(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background())
+	const n = 10
+	for i := 0; i < n; i++ {
+		Go(ctx, func() error {
+			<-ctx.Done()
+			time.Sleep(time.Duration(i) * time.Millisecond)
+			return nil
+		})
+	}
+	cancel()
+	var got [][2]int
+	if err := JoinGoWithProgress(ctx, func(done, total int) {
+		got = append(got, [2]int{done, total})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != n+1 {
+		t.Fatalf("got %d progress reports, want %d", len(got), n+1)
+	}
+	for i, p := range got {
+		if want := [2]int{i, n}; p != want {
+			t.Errorf("got %v, want %v", p, want)
+		}
+	}
+	if err := JoinGoWithProgress(context.Background(), nil); !errors.Is(err, ErrNotContainDoneGroup) {
+		t.Errorf("got %v, want %v", err, ErrNotContainDoneGroup)
+	}
+}
+
+func TestGoSync(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background())
+	errTest := errors.New("test error")
+	var started atomic.Bool
+	GoSync(ctx, func() error {
+		started.Store(true)
+		<-ctx.Done()
+		return errTest
+	})
+	// The goroutine has started, so the cancellation does not beat it
+	cancel()
+	if err := Wait(ctx); !errors.Is(err, errTest) {
+		t.Errorf("got %v, want %v", err, errTest)
+	}
+	if !started.Load() {
+		t.Error("the function should have been called")
+	}
+}
+
+func TestGoRequired(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background())
+	var required, bestEffort atomic.Bool
+	GoRequired(ctx, func() error {
+		<-ctx.Done()
+		time.Sleep(50 * time.Millisecond)
+		required.Store(true)
+		return nil
+	})
+	Go(ctx, func() error {
+		<-ctx.Done()
+		time.Sleep(time.Second)
+		bestEffort.Store(true)
+		return nil
+	})
+	cancel()
+	start := time.Now()
+	err := WaitWithTimeout(ctx, 10*time.Millisecond)
+	if !errors.Is(err, ErrWaitTimeout) {
+		t.Errorf("got %v, want %v", err, ErrWaitTimeout)
+	}
+	if errors.Is(err, ErrRequiredGoUnfinished) {
+		t.Errorf("got %v, should not be %v", err, ErrRequiredGoUnfinished)
+	}
+	if !required.Load() {
+		t.Error("the required process should complete before Wait returns")
+	}
+	if bestEffort.Load() {
+		t.Error("the best-effort process should be abandoned at the timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("got %v, should not wait for the best-effort process", elapsed)
+	}
+
+	t.Run("WithRequiredGoLimit", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := WithCancel(context.Background(), WithRequiredGoLimit(20*time.Millisecond))
+		child, _ := WithCancel(ctx)
+		GoRequired(child, func() error {
+			<-child.Done()
+			time.Sleep(time.Second)
+			return nil
+		})
+		cancel()
+		start := time.Now()
+		err := WaitWithTimeout(ctx, 10*time.Millisecond)
+		if !errors.Is(err, ErrWaitTimeout) || !errors.Is(err, ErrRequiredGoUnfinished) {
+			t.Errorf("got %v, want %v and %v", err, ErrWaitTimeout, ErrRequiredGoUnfinished)
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("got %v, should give up at the hard limit", elapsed)
+		}
+	})
+}
+
+func TestGoContextValues(t *testing.T) {
+	t.Parallel()
+	type correlationIDKey struct{}
+	ctx, cancel := WithCancel(context.WithValue(context.Background(), correlationIDKey{}, "req-1"))
+	got := make(chan any, 2)
+	Go(ctx, func() error {
+		got <- ctx.Value(correlationIDKey{})
+		return nil
+	})
+	GoWithContext(ctx, func(ctx context.Context) error {
+		got <- ctx.Value(correlationIDKey{})
+		<-ctx.Done()
+		return nil
+	})
+	for range 2 {
+		if v := <-got; v != "req-1" {
+			t.Errorf("got %v, want %v", v, "req-1")
+		}
+	}
+	cancel()
+	if err := Wait(ctx); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGoWithName(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background())
+	errTest := errors.New("connection reset")
+	GoWithName(ctx, "worker-7", func() error {
+		return errTest
+	})
+	GoWithName(ctx, "worker-8", func() error {
+		return nil
+	})
+	cancel()
+	err := Wait(ctx)
+	if !errors.Is(err, errTest) {
+		t.Errorf("got %v, want %v", err, errTest)
+	}
+	if want := "worker-7: connection reset"; err.Error() != want {
+		t.Errorf("got %q, want %q", err.Error(), want)
+	}
+}
+
+func TestGoWithError(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background())
+
+	var errTest = errors.New("test error")
+
+	Go(ctx, func() error {
+		time.Sleep(10 * time.Millisecond)
+		return errTest
+	})
+
+	defer func() {
+		cancel()
+
+		err := Wait(ctx)
+		if !errors.Is(err, errTest) {
+			t.Errorf("got %v, want %v", err, errTest)
+		}
+	}()
+}
+
+func TestFirstError(t *testing.T) {
+	t.Parallel()
+	t.Run("Receive the first error", func(t *testing.T) {
+		t.Parallel()
+		errTest := errors.New("test error")
+		ctx, cancel := WithCancel(context.Background())
+		defer cancel()
+		ch, err := FirstError(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		release := make(chan struct{})
+		Go(ctx, func() error {
+			return errTest
+		})
+		Go(ctx, func() error {
+			<-release
+			return errors.New("second error")
+		})
+		select {
+		case got := <-ch:
+			if !errors.Is(got, errTest) {
+				t.Errorf("got %v, want %v", got, errTest)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("first error not received")
+		}
+		close(release)
+		cancel()
+		if err := Wait(ctx); !errors.Is(err, errTest) {
+			t.Errorf("got %v, want %v", err, errTest)
+		}
+		ch2, err := FirstError(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := <-ch2; !errors.Is(got, errTest) {
+			t.Errorf("got %v, want %v", got, errTest)
+		}
+	})
+
+	t.Run("Closed without errors", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := WithCancel(context.Background())
+		ch, err := FirstError(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Cleanup(ctx, func() error {
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		select {
+		case got, ok := <-ch:
+			if ok {
+				t.Errorf("got %v, want closed", got)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("channel not closed")
+		}
+	})
+
+	t.Run("FirstError without WithCancel", func(t *testing.T) {
+		t.Parallel()
+		if _, err := FirstError(context.Background()); !errors.Is(err, ErrNotContainDoneGroup) {
+			t.Errorf("expected ErrNotContainDoneGroup, got %v", err)
+		}
+	})
+}
+
+func TestSettled(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background())
+	settled := Settled(ctx)
+	if settled != Settled(ctx) {
+		t.Error("expected the same channel")
+	}
+	cleanup := atomic.Bool{}
+	if err := Cleanup(ctx, func() error {
+		time.Sleep(10 * time.Millisecond)
+		cleanup.Store(true)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-settled:
+		t.Fatal("settled before cancellation")
+	default:
+	}
+	cancel()
+	<-ctx.Done()
+	select {
+	case <-settled:
+	case <-time.After(time.Second):
+		t.Fatal("not settled")
+	}
+	if !cleanup.Load() {
+		t.Error("settled before the cleanup finished")
+	}
+	if Settled(context.Background()) != nil {
+		t.Error("expected nil")
+	}
+}
+
+func TestShuttingDownBudgetExceeded(t *testing.T) {
+	t.Parallel()
+	rootCtx, cancel := WithCancel(context.Background())
+	ctx, _ := WithCancel(rootCtx)
+	if ShuttingDownBudgetExceeded(ctx) {
+		t.Error("budget should not be exceeded before Wait")
+	}
+	started := make(chan struct{})
+	bailed := make(chan bool, 1)
+	if err := Cleanup(ctx, func() error {
+		close(started)
+		for i := 0; i < 100; i++ {
+			if ShuttingDownBudgetExceeded(ctx) {
+				bailed <- true
+				return nil
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		bailed <- false
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	<-started
+	if ShuttingDownBudgetExceeded(ctx) {
+		t.Error("budget should not be exceeded before Wait")
+	}
+	// The cleanup function may bail out before Wait returns, so the error is not checked
+	_ = WaitWithTimeout(rootCtx, 20*time.Millisecond)
+	if !<-bailed {
+		t.Error("cleanup function should bail out after the budget is exceeded")
+	}
+	if ShuttingDownBudgetExceeded(context.Background()) {
+		t.Error("got true for the context without doneGroup")
+	}
+}
+
+func TestSentinelErrors(t *testing.T) {
 	t.Parallel()
-	ctx, cancel := WithCancel(context.Background())
-
-	var errTest = errors.New("test error")
-
-	Go(ctx, func() error {
-		time.Sleep(10 * time.Millisecond)
-		return errTest
+	t.Run("ErrNotContainDoneGroup", func(t *testing.T) {
+		t.Parallel()
+		if err := Cleanup(context.Background(), func() error { return nil }); !errors.Is(err, ErrNotContainDoneGroup) {
+			t.Errorf("got %v, want %v", err, ErrNotContainDoneGroup)
+		}
 	})
-
-	defer func() {
+	t.Run("ErrNilFunc", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := WithCancel(context.Background())
+		defer cancel()
+		if err := Cleanup(ctx, nil); !errors.Is(err, ErrNilFunc) {
+			t.Errorf("got %v, want %v", err, ErrNilFunc)
+		}
+		if err := CleanupWithContext(ctx, nil); !errors.Is(err, ErrNilFunc) {
+			t.Errorf("got %v, want %v", err, ErrNilFunc)
+		}
+		if _, err := CleanupOncePerContext(ctx, "token", nil); !errors.Is(err, ErrNilFunc) {
+			t.Errorf("got %v, want %v", err, ErrNilFunc)
+		}
+		for _, f := range []func(){
+			func() { Go(ctx, nil) },
+			func() { GoOrRun(ctx, nil) },
+			func() { GoOrRun(context.Background(), nil) },
+			func() { CleanupOrSkip(ctx, nil) },
+			func() { CleanupOrSkip(context.Background(), nil) },
+		} {
+			func() {
+				defer func() {
+					if r := recover(); r != ErrNilFunc {
+						t.Errorf("got %v, want %v", r, ErrNilFunc)
+					}
+				}()
+				f()
+			}()
+		}
+	})
+	t.Run("ErrAlreadyCanceled", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := WithCancel(context.Background())
 		cancel()
-
-		err := Wait(ctx)
-		if !errors.Is(err, errTest) {
-			t.Errorf("got %v, want %v", err, errTest)
+		if err := CancelWithCause(ctx, errors.New("test")); !errors.Is(err, ErrAlreadyCanceled) {
+			t.Errorf("got %v, want %v", err, ErrAlreadyCanceled)
 		}
-	}()
+	})
+	t.Run("ErrNotCancelable", func(t *testing.T) {
+		t.Parallel()
+		ctx := WithInheritedCancel(context.Background())
+		if err := Cancel(ctx); !errors.Is(err, ErrNotCancelable) {
+			t.Errorf("got %v, want %v", err, ErrNotCancelable)
+		}
+	})
+	t.Run("ErrWaitTimeout", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := WithCancel(context.Background())
+		if err := Cleanup(ctx, func() error {
+			time.Sleep(100 * time.Millisecond)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		err := WaitWithTimeout(ctx, 10*time.Millisecond)
+		if !errors.Is(err, ErrWaitTimeout) {
+			t.Errorf("got %v, want %v", err, ErrWaitTimeout)
+		}
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
 }
 
 func TestWithCancelCause(t *testing.T) {
@@ -663,6 +2190,43 @@ func TestWithDeadline(t *testing.T) {
 	}
 }
 
+func TestWithDeadlinePassed(t *testing.T) {
+	t.Parallel()
+	// The scheduler never calls f, so cleanup functions start only if the doneGroup drains at creation
+	scheduler := func(ctx context.Context, f func()) func() bool {
+		return func() bool { return true }
+	}
+	ctx, cancel := WithDeadline(context.Background(), time.Now().Add(-time.Second), WithScheduler(scheduler))
+	defer cancel()
+
+	release := make(chan struct{})
+	started := make(chan int, 3)
+	for i := range 3 {
+		if err := Cleanup(ctx, func() error {
+			started <- i
+			<-release
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// All the cleanup functions have started before Wait is called
+	for range 3 {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("cleanup function not started at registration")
+		}
+	}
+	close(release)
+	if err := Wait(ctx); err != nil {
+		t.Error(err)
+	}
+	if !errors.Is(context.Cause(ctx), context.DeadlineExceeded) {
+		t.Errorf("got %v, want %v", context.Cause(ctx), context.DeadlineExceeded)
+	}
+}
+
 func TestWithTimeout(t *testing.T) {
 	t.Parallel()
 	ctx, _ := WithTimeout(context.Background(), 5*time.Millisecond)
@@ -692,6 +2256,44 @@ func TestWithTimeout(t *testing.T) {
 	}
 }
 
+func TestCanceledByParentDeadline(t *testing.T) {
+	t.Parallel()
+	rootCtx, rootCancel := WithTimeout(context.Background(), 10*time.Millisecond)
+	defer rootCancel()
+	plainCtx, plainCancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer plainCancel()
+	// Children canceled purely by the deadline of the parent (a doneGroup context and a plain context)
+	childCtx, childCancel := WithCancel(rootCtx)
+	defer childCancel()
+	grandchildCtx, grandchildCancel := WithCancel(childCtx)
+	defer grandchildCancel()
+	otherCtx, otherCancel := WithCancel(plainCtx)
+	defer otherCancel()
+	var called atomic.Int64
+	for _, ctx := range []context.Context{childCtx, grandchildCtx, otherCtx} {
+		if err := Cleanup(ctx, func() error {
+			called.Add(1)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, ctx := range []context.Context{grandchildCtx, otherCtx} {
+		if err := Wait(ctx); err != nil {
+			t.Error(err)
+		}
+		if !errors.Is(context.Cause(ctx), context.DeadlineExceeded) {
+			t.Errorf("got %v, want %v", context.Cause(ctx), context.DeadlineExceeded)
+		}
+	}
+	if err := Wait(rootCtx); err != nil {
+		t.Error(err)
+	}
+	if got := called.Load(); got != 3 {
+		t.Errorf("got %d, want %d", got, 3)
+	}
+}
+
 func TestWithTimeoutCause(t *testing.T) {
 	t.Parallel()
 	var errTest = errors.New("test error")
@@ -746,8 +2348,8 @@ func TestCancelWithCause(t *testing.T) {
 			t.Error(err)
 		}
 
-		if err := CancelWithCause(ctx, errTest2); err != nil {
-			t.Error(err)
+		if err := CancelWithCause(ctx, errTest2); !errors.Is(err, ErrAlreadyCanceled) {
+			t.Errorf("got %v, want %v", err, ErrAlreadyCanceled)
 		}
 
 		if !errors.Is(context.Cause(ctx), errTest) {
@@ -757,6 +2359,258 @@ func TestCancelWithCause(t *testing.T) {
 			t.Error("got errTest2, want errTest")
 		}
 	})
+
+	t.Run("Cancel through a canceled derived context", func(t *testing.T) {
+		ctx, _ := WithCancel(context.Background())
+		derived, cancel := context.WithCancel(ctx)
+		cancel()
+
+		if err := CancelWithCause(derived, errTest); err != nil {
+			t.Error(err)
+		}
+
+		if !errors.Is(context.Cause(ctx), errTest) {
+			t.Errorf("got %v, want %v", context.Cause(ctx), errTest)
+		}
+	})
+}
+
+func TestWithInheritedCancel(t *testing.T) {
+	t.Parallel()
+	rootCtx, rootCancel := WithCancel(context.Background())
+	ctx := WithInheritedCancel(rootCtx)
+
+	cleanup := atomic.Bool{}
+	if err := Cleanup(ctx, func() error {
+		time.Sleep(10 * time.Millisecond)
+		cleanup.Store(true)
+		return nil
+	}); err != nil {
+		t.Error(err)
+	}
+
+	if err := Cancel(ctx); !errors.Is(err, ErrNotCancelable) {
+		t.Errorf("got %v, want %v", err, ErrNotCancelable)
+	}
+	if ctx.Err() != nil {
+		t.Error("expected not canceled")
+	}
+
+	rootCancel()
+	if err := Wait(ctx); err != nil {
+		t.Error(err)
+	}
+	if !cleanup.Load() {
+		t.Error("cleanup function not called")
+	}
+	if err := Wait(rootCtx); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCauseFunc(t *testing.T) {
+	t.Parallel()
+	errTest := errors.New("test error")
+	ctx, _ := WithCancel(context.Background())
+	cancel, err := CauseFunc(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel(errTest)
+	if err := Wait(ctx); err != nil {
+		t.Error(err)
+	}
+	if !errors.Is(context.Cause(ctx), errTest) {
+		t.Errorf("got %v, want %v", context.Cause(ctx), errTest)
+	}
+	if _, err := CauseFunc(context.Background()); !errors.Is(err, ErrNotContainDoneGroup) {
+		t.Errorf("got %v, want %v", err, ErrNotContainDoneGroup)
+	}
+	if _, err := CauseFunc(WithInheritedCancel(ctx)); !errors.Is(err, ErrNotCancelable) {
+		t.Errorf("got %v, want %v", err, ErrNotCancelable)
+	}
+}
+
+func TestCancelWithCauses(t *testing.T) {
+	t.Parallel()
+	errA := errors.New("a")
+	errB := errors.New("b")
+	errC := errors.New("c")
+	ctx, _ := WithCancel(context.Background())
+	errCleanup := make(chan error, 1)
+	if err := Cleanup(ctx, func() error {
+		errCleanup <- context.Cause(ctx)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := CancelWithCauses(ctx, errA, errB); err != nil {
+		t.Fatal(err)
+	}
+	// The first cause wins
+	if err := CancelWithCauses(ctx, errC); !errors.Is(err, ErrAlreadyCanceled) {
+		t.Errorf("got %v, want %v", err, ErrAlreadyCanceled)
+	}
+	if err := Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, cause := range []error{context.Cause(ctx), <-errCleanup} {
+		if !errors.Is(cause, errA) || !errors.Is(cause, errB) {
+			t.Errorf("got %v, want %v and %v", cause, errA, errB)
+		}
+		if errors.Is(cause, errC) {
+			t.Errorf("got %v, want not %v", cause, errC)
+		}
+	}
+}
+
+func TestConcurrentCancelWithCause(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background())
+	defer cancel()
+	var initiated atomic.Int64
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := CancelWithCause(ctx, fmt.Errorf("cause %d", i))
+			switch {
+			case err == nil:
+				initiated.Add(1)
+			case !errors.Is(err, ErrAlreadyCanceled):
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := initiated.Load(); got != 1 {
+		t.Errorf("got %d, want %d", got, 1)
+	}
+	if err := Cancel(ctx); err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+}
+
+func TestConcurrentCancelAndWait(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background())
+	defer cancel()
+	errTest := errors.New("test error")
+	var called atomic.Int64
+	for i := 0; i < 3; i++ {
+		if err := Cleanup(ctx, func() error {
+			called.Add(1)
+			time.Sleep(10 * time.Millisecond)
+			return errTest
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const n = 10
+	errs := make([]error, n)
+	wg := sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if i%2 == 0 {
+				_ = Cancel(ctx)
+			} else {
+				_ = CancelWithCause(ctx, fmt.Errorf("cause %d", i))
+			}
+			errs[i] = Wait(ctx)
+		}()
+	}
+	wg.Wait()
+	if got := called.Load(); got != 3 {
+		t.Errorf("got %d, want %d", got, 3)
+	}
+	for i, err := range errs {
+		if !errors.Is(err, errTest) {
+			t.Errorf("got %v, want %v", err, errTest)
+		}
+		if err.Error() != errs[0].Error() {
+			t.Errorf("caller %d got %v, want %v", i, err, errs[0])
+		}
+	}
+}
+
+func TestWithCancelAny(t *testing.T) {
+	t.Parallel()
+	errA := errors.New("a")
+	errB := errors.New("b")
+	tests := []struct {
+		name   string
+		cancel func(cancelA, cancelB context.CancelCauseFunc, cancel context.CancelFunc)
+		want   error
+	}{
+		{"first parent", func(cancelA, cancelB context.CancelCauseFunc, cancel context.CancelFunc) { cancelA(errA) }, errA},
+		{"second parent", func(cancelA, cancelB context.CancelCauseFunc, cancel context.CancelFunc) { cancelB(errB) }, errB},
+		{"own cancel", func(cancelA, cancelB context.CancelCauseFunc, cancel context.CancelFunc) { cancel() }, context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			parentA, cancelA := context.WithCancelCause(context.Background())
+			defer cancelA(nil)
+			parentB, cancelB := context.WithCancelCause(context.Background())
+			defer cancelB(nil)
+			ctx, cancel := WithCancelAny(parentA, parentB)
+			defer cancel()
+			called := atomic.Bool{}
+			if err := Cleanup(ctx, func() error {
+				called.Store(true)
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			tt.cancel(cancelA, cancelB, cancel)
+			if err := Wait(ctx); err != nil {
+				t.Error(err)
+			}
+			if !called.Load() {
+				t.Error("cleanup function not called")
+			}
+			if got := context.Cause(ctx); !errors.Is(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithCancelWait(t *testing.T) {
+	t.Parallel()
+	errTest := errors.New("test error")
+	t.Run("WithCancelWait", func(t *testing.T) {
+		t.Parallel()
+		ctx, done := WithCancelWait(context.Background())
+		if err := Cleanup(ctx, func() error {
+			time.Sleep(10 * time.Millisecond)
+			return errTest
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := done(); !errors.Is(err, errTest) {
+			t.Errorf("got %v, want %v", err, errTest)
+		}
+		if ctx.Err() == nil {
+			t.Error("context not canceled")
+		}
+	})
+	t.Run("WithCancelWaitTimeout", func(t *testing.T) {
+		t.Parallel()
+		ctx, done := WithCancelWaitTimeout(context.Background(), 10*time.Millisecond)
+		if err := Cleanup(ctx, func() error {
+			time.Sleep(100 * time.Millisecond)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := done(); !errors.Is(err, ErrWaitTimeout) {
+			t.Errorf("got %v, want %v", err, ErrWaitTimeout)
+		}
+	})
 }
 
 func TestWithoutCancel(t *testing.T) {
@@ -785,3 +2639,163 @@ func TestWithoutCancel(t *testing.T) {
 		t.Error("cleanup function not called")
 	}
 }
+
+func BenchmarkAwaiter(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ctx, cancel := WithCancel(context.Background())
+		completes := make([]func(), 0, 100000)
+		for j := 0; j < 100000; j++ {
+			completed, err := Awaiter(ctx)
+			if err != nil {
+				b.Fatal(err)
+			}
+			completes = append(completes, completed)
+		}
+		for _, completed := range completes {
+			completed()
+		}
+		cancel()
+		if err := Wait(ctx); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestWaitNoCleanupAllocs(t *testing.T) {
+	ctx, cancel := WithCancel(context.Background())
+	cancel()
+	allocs := testing.AllocsPerRun(100, func() {
+		if err := Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("got %v allocs, want 0", allocs)
+	}
+}
+
+func BenchmarkWaitNoCleanup(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		ctx, cancel := WithCancel(context.Background())
+		cancel()
+		b.StartTimer()
+		if err := Wait(ctx); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWaitSingleCleanup(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ctx, cancel := WithCancel(context.Background())
+		if err := Cleanup(ctx, func() error { return nil }); err != nil {
+			b.Fatal(err)
+		}
+		cancel()
+		if err := Wait(ctx); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWaitWithTimeoutSingleCleanup(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ctx, cancel := WithCancel(context.Background())
+		if err := Cleanup(ctx, func() error { return nil }); err != nil {
+			b.Fatal(err)
+		}
+		cancel()
+		if err := WaitWithTimeout(ctx, time.Second); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWaitTree(b *testing.B) {
+	// The root has a critical cleanup function, and the wide leaf level has many cleanup functions competing for CPU.
+	// It reports the latency from the cancellation to the start and to the end of the root cleanup function.
+	spin := func() error {
+		var x uint64
+		for i := range uint64(100000) {
+			x += i * i
+		}
+		_ = x
+		return nil
+	}
+	for _, bb := range []struct {
+		name string
+		opts []Option
+	}{
+		{"simultaneous", nil},
+		{"leaf first", []Option{WithLeafFirst()}},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			var start, done time.Duration
+			for i := 0; i < b.N; i++ {
+				ctx, cancel := WithCancel(context.Background(), bb.opts...)
+				for range 10 {
+					child, _ := WithCancel(ctx)
+					for range 100 {
+						if err := Cleanup(child, spin); err != nil {
+							b.Fatal(err)
+						}
+					}
+				}
+				var canceled time.Time
+				if err := Cleanup(ctx, func() error {
+					start += time.Since(canceled)
+					err := spin()
+					done += time.Since(canceled)
+					return err
+				}); err != nil {
+					b.Fatal(err)
+				}
+				canceled = time.Now()
+				cancel()
+				if err := Wait(ctx); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(start.Nanoseconds())/float64(b.N), "root-start-ns/op")
+			b.ReportMetric(float64(done.Nanoseconds())/float64(b.N), "root-done-ns/op")
+		})
+	}
+}
+
+func BenchmarkWaitCPUBoundCleanups(b *testing.B) {
+	spin := func() error {
+		var x uint64
+		for i := range uint64(100000) {
+			x += i * i
+		}
+		_ = x
+		return nil
+	}
+	for _, bb := range []struct {
+		name string
+		opts []Option
+	}{
+		{"goroutine per cleanup", nil},
+		{"GOMAXPROCS pool", []Option{WithCPUBoundCleanups()}},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				ctx, cancel := WithCancel(context.Background(), bb.opts...)
+				for range 1000 {
+					if err := Cleanup(ctx, spin); err != nil {
+						b.Fatal(err)
+					}
+				}
+				cancel()
+				if err := Wait(ctx); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
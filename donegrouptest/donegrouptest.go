@@ -0,0 +1,52 @@
+// Package donegrouptest provides utilities for testing the code using donegroup.
+package donegrouptest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/k1LoW/donegroup"
+)
+
+// AssertAllCleaned cancels the context, waits for the cleanup functions, and fails the test if any of them returned an error.
+// It also fails the test if the number of the executed cleanup functions does not match the number of the registered ones (e.g. they were discarded by donegroup.Discard).
+// Note that the counts are of the doneGroup itself, while the errors are of the entire subtree.
+func AssertAllCleaned(t testing.TB, ctx context.Context) {
+	t.Helper()
+	assertAllCleaned(t, func() (*donegroup.Info, error) {
+		return donegroup.Inspect(ctx)
+	}, func() error {
+		return donegroup.WaitAndCancel(ctx)
+	})
+}
+
+// AssertAllCleanedWithKey cancels the context, waits for the cleanup functions, and fails the test if any of them returned an error.
+// It also fails the test if the number of the executed cleanup functions does not match the number of the registered ones (e.g. they were discarded by donegroup.DiscardWithKey).
+// Note that the counts are of the doneGroup itself, while the errors are of the entire subtree.
+func AssertAllCleanedWithKey(t testing.TB, ctx context.Context, key any) {
+	t.Helper()
+	assertAllCleaned(t, func() (*donegroup.Info, error) {
+		return donegroup.InspectWithKey(ctx, key)
+	}, func() error {
+		return donegroup.WaitAndCancelWithKey(ctx, key)
+	})
+}
+
+func assertAllCleaned(t testing.TB, inspect func() (*donegroup.Info, error), waitAndCancel func() error) {
+	t.Helper()
+	if _, err := inspect(); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := waitAndCancel(); err != nil {
+		t.Errorf("donegroup: cleanup functions failed: %v", err)
+	}
+	info, err := inspect()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if info.Executed != info.Cleanups {
+		t.Errorf("donegroup: %d cleanup functions registered, but %d executed", info.Cleanups, info.Executed)
+	}
+}
@@ -0,0 +1,83 @@
+package donegrouptest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/k1LoW/donegroup"
+)
+
+// recorderTB records the failures instead of failing the test.
+type recorderTB struct {
+	testing.TB
+	errs []string
+}
+
+func (r *recorderTB) Helper() {}
+
+func (r *recorderTB) Error(args ...any) {
+	r.errs = append(r.errs, fmt.Sprint(args...))
+}
+
+func (r *recorderTB) Errorf(format string, args ...any) {
+	r.errs = append(r.errs, fmt.Sprintf(format, args...))
+}
+
+func TestAssertAllCleaned(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		setup    func(ctx context.Context) error
+		wantErrs int
+	}{
+		{
+			name: "all cleaned",
+			setup: func(ctx context.Context) error {
+				return donegroup.Cleanup(ctx, func() error { return nil })
+			},
+			wantErrs: 0,
+		},
+		{
+			name: "cleanup error",
+			setup: func(ctx context.Context) error {
+				return donegroup.Cleanup(ctx, func() error { return errors.New("cleanup failed") })
+			},
+			wantErrs: 1,
+		},
+		{
+			name: "discarded",
+			setup: func(ctx context.Context) error {
+				if err := donegroup.Cleanup(ctx, func() error { return nil }); err != nil {
+					return err
+				}
+				return donegroup.Discard(ctx)
+			},
+			wantErrs: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx, _ := donegroup.WithCancel(context.Background())
+			if err := tt.setup(ctx); err != nil {
+				t.Fatal(err)
+			}
+			r := &recorderTB{TB: t}
+			AssertAllCleaned(r, ctx)
+			if len(r.errs) != tt.wantErrs {
+				t.Errorf("got %v, want %d failures", r.errs, tt.wantErrs)
+			}
+		})
+	}
+
+	t.Run("without WithCancel", func(t *testing.T) {
+		t.Parallel()
+		r := &recorderTB{TB: t}
+		AssertAllCleaned(r, context.Background())
+		if len(r.errs) != 1 {
+			t.Errorf("got %v, want 1 failure", r.errs)
+		}
+	})
+}
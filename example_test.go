@@ -10,12 +10,12 @@ import (
 )
 
 func Example() {
-	ctx, cancel := donegroup.WithCancel(context.Background())
+	// Execute the cleanup functions one by one in the order of registration to make the output deterministic
+	ctx, cancel := donegroup.WithCancel(context.Background(), donegroup.WithMaxConcurrentCleanups(1))
 
 	// Cleanup process of some kind
 	if err := donegroup.Cleanup(ctx, func() error {
-		time.Sleep(10 * time.Millisecond)
-		fmt.Println("cleanup with sleep")
+		fmt.Println("cleanup")
 		return nil
 	}); err != nil {
 		log.Fatal(err)
@@ -23,7 +23,8 @@ func Example() {
 
 	// Cleanup process of some kind
 	if err := donegroup.Cleanup(ctx, func() error {
-		fmt.Println("cleanup")
+		time.Sleep(10 * time.Millisecond)
+		fmt.Println("cleanup with sleep")
 		return nil
 	}); err != nil {
 		log.Fatal(err)
@@ -119,10 +120,14 @@ func ExampleWaitWithTimeout() {
 	ctx, cancel := donegroup.WithCancel(context.Background())
 
 	// Cleanup process of some kind
-	if err := donegroup.Cleanup(ctx, func() error {
+	if err := donegroup.CleanupWithContext(ctx, func(ctx context.Context) error {
 		fmt.Println("cleanup start")
 		for i := 0; i < 10; i++ {
-			time.Sleep(2 * time.Millisecond)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(2 * time.Millisecond):
+			}
 		}
 		fmt.Println("cleanup finish")
 		return nil
@@ -147,5 +152,5 @@ func ExampleWaitWithTimeout() {
 	// main start
 	// main finish
 	// cleanup start
-	// context deadline exceeded
+	// donegroup: waiting for cleanup functions gave up: context deadline exceeded
 }
@@ -0,0 +1,212 @@
+package donegroup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Default exit codes returned by ExitCode.
+const (
+	// ExitCodeOK is the exit code for clean shutdown.
+	ExitCodeOK = 0
+	// ExitCodeCleanupError is the exit code when the cleanup functions returned errors.
+	ExitCodeCleanupError = 1
+	// ExitCodeCause is the exit code when the context was canceled with a cause other than context.Canceled.
+	ExitCodeCause = 2
+	// ExitCodeTimeout is the exit code when waiting for the cleanup functions timed out.
+	ExitCodeTimeout = 3
+)
+
+// ExitStatus is the result of shutdown used to determine the exit code.
+type ExitStatus struct {
+	// Cause is the cancellation cause of the context.
+	Cause error
+	// Err is the error returned by Wait.
+	Err error
+	// TimedOut reports whether waiting for the cleanup functions timed out.
+	TimedOut bool
+}
+
+// DefaultExitCoder returns the exit code for the status.
+// The exit code is determined in the following order.
+//
+//   - ExitCodeTimeout if waiting for the cleanup functions timed out.
+//   - ExitCodeCleanupError if the cleanup functions returned errors.
+//   - The code of *ShutdownCause if the context was canceled with it (e.g. by CancelWithExit).
+//   - ExitCodeCause if the context was canceled with a cause other than context.Canceled.
+//   - ExitCodeOK otherwise.
+func DefaultExitCoder(s ExitStatus) int {
+	var sc *ShutdownCause
+	switch {
+	case s.TimedOut:
+		return ExitCodeTimeout
+	case s.Err != nil:
+		return ExitCodeCleanupError
+	case errors.As(s.Cause, &sc):
+		return sc.Code
+	case s.Cause != nil && !errors.Is(s.Cause, context.Canceled):
+		return ExitCodeCause
+	default:
+		return ExitCodeOK
+	}
+}
+
+// ShutdownCause is the cancellation cause carrying the exit metadata of the shutdown.
+// It round-trips through CancelWithCause and context.Cause, and DefaultExitCoder returns its Code.
+type ShutdownCause struct {
+	// Code is the exit code.
+	Code int
+	// Category is the category of the shutdown (e.g. "deploy", "config-error").
+	Category string
+	// Err is the reason of the shutdown.
+	Err error
+}
+
+// Error returns the exit code, the category and the reason.
+func (c *ShutdownCause) Error() string {
+	msg := fmt.Sprintf("donegroup: shutdown (code=%d", c.Code)
+	if c.Category != "" {
+		msg += fmt.Sprintf(", category=%s", c.Category)
+	}
+	msg += ")"
+	if c.Err != nil {
+		msg += ": " + c.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the reason of the shutdown.
+func (c *ShutdownCause) Unwrap() error {
+	return c.Err
+}
+
+// CancelWithExit cancels the context with a cause of *ShutdownCause carrying the exit code and the reason.
+// If the context is already canceled, it returns ErrAlreadyCanceled and the cause is not changed (the first cause wins).
+func CancelWithExit(ctx context.Context, code int, err error) error {
+	return CancelWithExitAndKey(ctx, code, err, doneGroupKey)
+}
+
+// CancelWithExitAndKey cancels the context with a cause of *ShutdownCause carrying the exit code and the reason.
+// If the context is already canceled, it returns ErrAlreadyCanceled and the cause is not changed (the first cause wins).
+func CancelWithExitAndKey(ctx context.Context, code int, err error, key any) error {
+	return CancelWithCauseAndKey(ctx, &ShutdownCause{Code: code, Err: err}, key)
+}
+
+// WithExitCoder sets the function to determine the exit code returned by ExitCode.
+// Default is DefaultExitCoder.
+func WithExitCoder(f func(ExitStatus) int) Option {
+	return func(c *config) {
+		c.exitCoder = f
+	}
+}
+
+// DefaultFatalCause reports whether the cancellation cause is fatal for WaitOrPanic.
+// The cause other than context.Canceled is fatal.
+func DefaultFatalCause(cause error) bool {
+	return cause != nil && !errors.Is(cause, context.Canceled)
+}
+
+// WithFatalCause sets the function to determine whether the cancellation cause is fatal for WaitOrPanic.
+// Default is DefaultFatalCause.
+func WithFatalCause(f func(cause error) bool) Option {
+	return func(c *config) {
+		c.fatalCause = f
+	}
+}
+
+// WaitOrPanic blocks until the context is canceled. Then calls the function registered by Cleanup, and panics if the cancellation cause is fatal or the cleanup functions returned errors.
+// It is the "clean up, then crash loudly" pattern for the top of main: the cleanup functions always complete (or the wait times out) before the panic,
+// and the panic value is an error wrapping the fatal cause and the errors of Wait, so crash reporting can capture the reason.
+// Whether the cause is fatal is determined by WithFatalCause (Default is DefaultFatalCause).
+// If the default wait timeout is set by WithWaitTimeout, it waits like WaitWithTimeout.
+func WaitOrPanic(ctx context.Context) {
+	WaitOrPanicWithKey(ctx, doneGroupKey)
+}
+
+// WaitOrPanicWithKey blocks until the context is canceled. Then calls the function registered by Cleanup, and panics if the cancellation cause is fatal or the cleanup functions returned errors.
+// It is the "clean up, then crash loudly" pattern for the top of main: the cleanup functions always complete (or the wait times out) before the panic,
+// and the panic value is an error wrapping the fatal cause and the errors of Wait, so crash reporting can capture the reason.
+// Whether the cause is fatal is determined by WithFatalCause (Default is DefaultFatalCause).
+// If the default wait timeout is set by WithWaitTimeout, it waits like WaitWithTimeout.
+func WaitOrPanicWithKey(ctx context.Context, key any) {
+	err := WaitWithKey(ctx, key)
+	fatal := DefaultFatalCause
+	if dg, ok := ctx.Value(key).(*doneGroup); ok && dg.config.fatalCause != nil {
+		fatal = dg.config.fatalCause
+	}
+	var errs []error
+	if cause := context.Cause(ctx); cause != nil && fatal(cause) {
+		errs = append(errs, cause)
+	}
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return
+	}
+	panic(fmt.Errorf("donegroup: fatal shutdown: %w", errors.Join(errs...)))
+}
+
+// ExitCode cancels the context and waits for the cleanup functions. Then returns the exit code.
+// It does not call os.Exit.
+// If the default wait timeout is set by WithWaitTimeout, it waits like ExitCodeWithTimeout.
+// If the doneGroup does not have its own cancel func (e.g. WithInheritedCancel) and the context is not canceled yet, it returns the exit code for ErrNotCancelable without waiting.
+func ExitCode(ctx context.Context) int {
+	return ExitCodeWithKey(ctx, doneGroupKey)
+}
+
+// ExitCodeWithTimeout cancels the context and waits for the cleanup functions with timeout. Then returns the exit code.
+// It does not call os.Exit.
+// If the doneGroup does not have its own cancel func (e.g. WithInheritedCancel) and the context is not canceled yet, it returns the exit code for ErrNotCancelable without waiting.
+func ExitCodeWithTimeout(ctx context.Context, timeout time.Duration) int {
+	return ExitCodeWithTimeoutAndKey(ctx, timeout, doneGroupKey)
+}
+
+// ExitCodeWithKey cancels the context and waits for the cleanup functions. Then returns the exit code.
+// It does not call os.Exit.
+// If the default wait timeout is set by WithWaitTimeout, it waits like ExitCodeWithTimeoutAndKey.
+// If the doneGroup does not have its own cancel func (e.g. WithInheritedCancelWithKey) and the context is not canceled yet, it returns the exit code for ErrNotCancelable without waiting.
+func ExitCodeWithKey(ctx context.Context, key any) int {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return DefaultExitCoder(ExitStatus{Err: ErrNotContainDoneGroup})
+	}
+	ctxw, cancel := dg.defaultWaitContext(ctx)
+	defer cancel()
+	if ctxw == nil {
+		ctxw = context.WithoutCancel(ctx)
+	}
+	return exitCode(ctx, ctxw, key)
+}
+
+// ExitCodeWithTimeoutAndKey cancels the context and waits for the cleanup functions with timeout. Then returns the exit code.
+// It does not call os.Exit.
+// If the doneGroup does not have its own cancel func (e.g. WithInheritedCancelWithKey) and the context is not canceled yet, it returns the exit code for ErrNotCancelable without waiting.
+func ExitCodeWithTimeoutAndKey(ctx context.Context, timeout time.Duration, key any) int {
+	ctxw, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+	return exitCode(ctx, ctxw, key)
+}
+
+func exitCode(ctx, ctxw context.Context, key any) int {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return DefaultExitCoder(ExitStatus{Err: ErrNotContainDoneGroup})
+	}
+	coder := DefaultExitCoder
+	if dg.config.exitCoder != nil {
+		coder = dg.config.exitCoder
+	}
+	if err := dg.cancelWithCause(nil, callerStack); errors.Is(err, ErrNotCancelable) && ctx.Err() == nil {
+		// Waiting blocks until the parent is canceled
+		return coder(ExitStatus{Err: err})
+	}
+	err := WaitWithContextAndKey(ctx, ctxw, key)
+	return coder(ExitStatus{
+		Cause:    context.Cause(ctx),
+		Err:      err,
+		TimedOut: errors.Is(err, ErrWaitTimeout),
+	})
+}
@@ -0,0 +1,179 @@
+package donegroup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestExitCode(t *testing.T) {
+	t.Parallel()
+	errTest := errors.New("test error")
+	tests := []struct {
+		name    string
+		cause   error
+		cleanup func() error
+		timeout time.Duration
+		want    int
+	}{
+		{"clean shutdown", nil, func() error { return nil }, time.Second, ExitCodeOK},
+		{"cleanup error", nil, func() error { return errTest }, time.Second, ExitCodeCleanupError},
+		{"fatal cause", errTest, func() error { return nil }, time.Second, ExitCodeCause},
+		{"timeout", nil, func() error {
+			time.Sleep(100 * time.Millisecond)
+			return nil
+		}, 5 * time.Millisecond, ExitCodeTimeout},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx, _ := WithCancel(context.Background())
+			if err := Cleanup(ctx, tt.cleanup); err != nil {
+				t.Fatal(err)
+			}
+			if tt.cause != nil {
+				if err := CancelWithCause(ctx, tt.cause); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := ExitCodeWithTimeout(ctx, tt.timeout); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("WithExitCoder", func(t *testing.T) {
+		t.Parallel()
+		ctx, _ := WithCancel(context.Background(), WithExitCoder(func(s ExitStatus) int {
+			if errors.Is(s.Err, errTest) {
+				return 42
+			}
+			return 0
+		}))
+		if err := Cleanup(ctx, func() error { return errTest }); err != nil {
+			t.Fatal(err)
+		}
+		if got := ExitCode(ctx); got != 42 {
+			t.Errorf("got %d, want %d", got, 42)
+		}
+	})
+
+	t.Run("WithWaitTimeout", func(t *testing.T) {
+		t.Parallel()
+		ctx, _ := WithCancel(context.Background(), WithWaitTimeout(5*time.Millisecond))
+		if err := Cleanup(ctx, func() error {
+			time.Sleep(100 * time.Millisecond)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if got := ExitCode(ctx); got != ExitCodeTimeout {
+			t.Errorf("got %d, want %d", got, ExitCodeTimeout)
+		}
+	})
+
+	t.Run("WithInheritedCancel", func(t *testing.T) {
+		t.Parallel()
+		parent, cancel := WithCancel(context.Background())
+		ctx := WithInheritedCancel(parent)
+		if got := ExitCode(ctx); got != ExitCodeCleanupError {
+			t.Errorf("got %d, want %d", got, ExitCodeCleanupError)
+		}
+		cancel()
+		if got := ExitCode(ctx); got != ExitCodeOK {
+			t.Errorf("got %d, want %d", got, ExitCodeOK)
+		}
+	})
+
+	t.Run("ExitCode without WithCancel", func(t *testing.T) {
+		t.Parallel()
+		if got := ExitCode(context.Background()); got != ExitCodeCleanupError {
+			t.Errorf("got %d, want %d", got, ExitCodeCleanupError)
+		}
+	})
+}
+
+func TestCancelWithExit(t *testing.T) {
+	t.Parallel()
+	errDeploy := errors.New("new version deployed")
+	ctx, _ := WithCancel(context.Background())
+	if err := CancelWithExit(ctx, 75, errDeploy); err != nil {
+		t.Fatal(err)
+	}
+	var sc *ShutdownCause
+	if !errors.As(context.Cause(ctx), &sc) {
+		t.Fatalf("got %v, want *ShutdownCause", context.Cause(ctx))
+	}
+	if sc.Code != 75 || !errors.Is(sc, errDeploy) {
+		t.Errorf("got %+v, want code 75 and %v", sc, errDeploy)
+	}
+	if got, want := sc.Error(), "donegroup: shutdown (code=75): new version deployed"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := ExitCode(ctx); got != 75 {
+		t.Errorf("got %d, want %d", got, 75)
+	}
+	if got, want := (&ShutdownCause{Code: 1, Category: "config-error"}).Error(), "donegroup: shutdown (code=1, category=config-error)"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestWaitOrPanic(t *testing.T) {
+	t.Parallel()
+	errTest := errors.New("test error")
+	errGraceful := errors.New("graceful")
+	tests := []struct {
+		name      string
+		opts      []Option
+		cause     error
+		cleanup   func() error
+		wantPanic error
+	}{
+		{"clean shutdown", nil, nil, func() error { return nil }, nil},
+		{"fatal cause", nil, errTest, func() error { return nil }, errTest},
+		{"cleanup error", nil, nil, func() error { return errTest }, errTest},
+		{"graceful cause", []Option{WithFatalCause(func(cause error) bool {
+			return !errors.Is(cause, errGraceful)
+		})}, errGraceful, func() error { return nil }, nil},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := WithCancel(context.Background(), tt.opts...)
+			cleaned := false
+			if err := Cleanup(ctx, func() error {
+				cleaned = true
+				return tt.cleanup()
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if tt.cause != nil {
+				if err := CancelWithCause(ctx, tt.cause); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				cancel()
+			}
+			defer func() {
+				v := recover()
+				if !cleaned {
+					t.Error("the cleanup function should be called before the panic")
+				}
+				if tt.wantPanic == nil {
+					if v != nil {
+						t.Errorf("got panic %v, want no panic", v)
+					}
+					return
+				}
+				err, ok := v.(error)
+				if !ok || !errors.Is(err, tt.wantPanic) {
+					t.Errorf("got panic %v, want %v", v, tt.wantPanic)
+				}
+			}()
+			WaitOrPanic(ctx)
+		})
+	}
+}
@@ -0,0 +1,312 @@
+package donegroup
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Info is a snapshot of the state of the doneGroup.
+type Info struct {
+	// CleanupGroups is the number of cleanup groups (the doneGroup itself and its descendants).
+	CleanupGroups int
+	// Cleanups is the number of cleanup functions registered with the doneGroup.
+	Cleanups int
+	// Executed is the number of cleanup functions that have been called and finished.
+	Executed int
+	// Pending is the number of cleanup functions that are registered but not finished yet.
+	Pending int
+	// Waiting reports whether Wait is in progress.
+	Waiting bool
+	// Canceled reports whether the context is canceled.
+	Canceled bool
+	// Cause is the cancellation cause of the context. It is nil if the context is not canceled.
+	Cause error
+	// CanceledByAncestor reports whether the context is canceled by the cancellation of the parent context (not by its own cancel func or deadline).
+	// The cause is inherited from the parent in that case.
+	CanceledByAncestor bool
+	// Depth is the depth of the doneGroup in the hierarchy. The root doneGroup is 0.
+	Depth int
+}
+
+// String returns a human-readable summary of the state of the doneGroup.
+// e.g. "donegroup: 3 registered, 1 pending, canceled(cause=context.DeadlineExceeded), depth=2".
+func (i *Info) String() string {
+	state := "not canceled"
+	if i.Canceled {
+		state = fmt.Sprintf("canceled(cause=%s)", causeString(i.Cause))
+	}
+	if i.Waiting {
+		state += ", waiting"
+	}
+	return fmt.Sprintf("donegroup: %d registered, %d pending, %s, depth=%d", i.Cleanups, i.Pending, state, i.Depth)
+}
+
+func causeString(cause error) string {
+	switch cause {
+	case nil:
+		return "<nil>"
+	case context.Canceled:
+		return "context.Canceled"
+	case context.DeadlineExceeded:
+		return "context.DeadlineExceeded"
+	default:
+		return cause.Error()
+	}
+}
+
+// Inspect returns a snapshot of the state of the doneGroup.
+func Inspect(ctx context.Context) (*Info, error) {
+	return InspectWithKey(ctx, doneGroupKey)
+}
+
+// InspectWithKey returns a snapshot of the state of the doneGroup.
+func InspectWithKey(ctx context.Context, key any) (*Info, error) {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return nil, ErrNotContainDoneGroup
+	}
+	dg.mu.Lock()
+	defer dg.mu.Unlock()
+	return &Info{
+		CleanupGroups:      len(dg.cleanupGroups),
+		Cleanups:           dg.registered,
+		Executed:           dg.executed,
+		Pending:            dg.pending,
+		Waiting:            dg.waiting > 0,
+		Canceled:           ctx.Err() != nil,
+		Cause:              context.Cause(ctx),
+		Depth:              dg.depth,
+		CanceledByAncestor: dg.canceledByAncestor(),
+	}, nil
+}
+
+// RegistrationTimes returns the times when the cleanup functions were registered with the doneGroup, in the order of registration.
+// It is intended for debugging the order of registration.
+func RegistrationTimes(ctx context.Context) ([]time.Time, error) {
+	return RegistrationTimesWithKey(ctx, doneGroupKey)
+}
+
+// RegistrationTimesWithKey returns the times when the cleanup functions were registered with the doneGroup, in the order of registration.
+// It is intended for debugging the order of registration.
+func RegistrationTimesWithKey(ctx context.Context, key any) ([]time.Time, error) {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return nil, ErrNotContainDoneGroup
+	}
+	dg.mu.Lock()
+	defer dg.mu.Unlock()
+	return slices.Clone(dg.registeredAt), nil
+}
+
+// TagStats is the aggregate of the cleanup functions registered with the same tag by CleanupTagged.
+type TagStats struct {
+	// Cleanups is the number of cleanup functions registered with the tag.
+	Cleanups int
+	// Pending is the number of cleanup functions with the tag that are registered but not finished yet.
+	Pending int
+	// Duration is the total execution time of the finished cleanup functions with the tag.
+	Duration time.Duration
+}
+
+// Tags returns a snapshot of the aggregate of the cleanup functions per tag.
+func Tags(ctx context.Context) (map[string]TagStats, error) {
+	return TagsWithKey(ctx, doneGroupKey)
+}
+
+// TagsWithKey returns a snapshot of the aggregate of the cleanup functions per tag.
+func TagsWithKey(ctx context.Context, key any) (map[string]TagStats, error) {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return nil, ErrNotContainDoneGroup
+	}
+	dg.mu.Lock()
+	defer dg.mu.Unlock()
+	tags := make(map[string]TagStats, len(dg.tags))
+	for tag, ts := range dg.tags {
+		tags[tag] = *ts
+	}
+	return tags, nil
+}
+
+// canceledByAncestor reports whether the context of the doneGroup is canceled by the cancellation of the parent context.
+func (dg *doneGroup) canceledByAncestor() bool {
+	if dg.ctx.Err() == nil || dg.parentCtx.Err() == nil || dg.canceledOwn.Load() {
+		return false
+	}
+	if context.Cause(dg.ctx) != context.Cause(dg.parentCtx) {
+		// The cancellation by the parent propagates its cause, so it is canceled by its own deadline
+		return false
+	}
+	if !dg.ownDeadline.IsZero() && !time.Now().Before(dg.ownDeadline) {
+		// Both are canceled by the deadlines with the same cause, and the earlier one wins
+		pd, ok := dg.parentCtx.Deadline()
+		return ok && pd.Before(dg.ownDeadline)
+	}
+	return true
+}
+
+// Depth returns the depth of the doneGroup in the hierarchy.
+// It returns 0 for the root doneGroup and increments for each nested doneGroup.
+func Depth(ctx context.Context) (int, error) {
+	return DepthWithKey(ctx, doneGroupKey)
+}
+
+// DepthWithKey returns the depth of the doneGroup in the hierarchy.
+// It returns 0 for the root doneGroup and increments for each nested doneGroup.
+func DepthWithKey(ctx context.Context, key any) (int, error) {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return 0, ErrNotContainDoneGroup
+	}
+	return dg.depth, nil
+}
+
+// ActiveGoroutines returns the number of the goroutines managed by the doneGroup and its descendants that are currently alive.
+// They are the goroutines executing the cleanup functions and the processes guarded by Awaiter (or Go).
+// It returns 0 after Wait returns without timeout, so it can be used for leak checks in tests.
+// It returns 0 if the context does not contain a doneGroup.
+func ActiveGoroutines(ctx context.Context) int {
+	return ActiveGoroutinesWithKey(ctx, doneGroupKey)
+}
+
+// ActiveGoroutinesWithKey returns the number of the goroutines managed by the doneGroup and its descendants that are currently alive.
+// They are the goroutines executing the cleanup functions and the processes guarded by AwaiterWithKey (or GoWithKey).
+// It returns 0 after WaitWithKey returns without timeout, so it can be used for leak checks in tests.
+// It returns 0 if the context does not contain a doneGroup.
+func ActiveGoroutinesWithKey(ctx context.Context, key any) int {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return 0
+	}
+	return dg.activeGoroutines()
+}
+
+// RunningCleanups returns the names of the cleanup functions of the doneGroup and its descendants that have started but not finished at the moment of the call.
+// The names are given by CleanupWithName, and the unnamed cleanup functions are reported as "". The names are sorted.
+// It returns an empty slice before the context is canceled. It is intended for a watchdog polling during a long shutdown (see CleanupContext).
+func RunningCleanups(ctx context.Context) ([]string, error) {
+	return RunningCleanupsWithKey(ctx, doneGroupKey)
+}
+
+// RunningCleanupsWithKey returns the names of the cleanup functions of the doneGroup and its descendants that have started but not finished at the moment of the call.
+// The names are given by CleanupWithNameAndKey, and the unnamed cleanup functions are reported as "". The names are sorted.
+// It returns an empty slice before the context is canceled. It is intended for a watchdog polling during a long shutdown (see CleanupContextWithKey).
+func RunningCleanupsWithKey(ctx context.Context, key any) ([]string, error) {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return nil, ErrNotContainDoneGroup
+	}
+	names := dg.runningCleanups()
+	slices.Sort(names)
+	return names, nil
+}
+
+// CancellerStack returns the stack trace of the caller of CancelWithCause that canceled the context, captured by WithCancellerStack.
+// For the cancellation by WithCancelOnError or WithDeferredCancelOnError, it is the stack of the caller of Go that started the process triggering it.
+// It returns nil if WithCancellerStack is not set or the context is not canceled by CancelWithCause (e.g. by the cancel func or the parent).
+func CancellerStack(ctx context.Context) []byte {
+	return CancellerStackWithKey(ctx, doneGroupKey)
+}
+
+// CancellerStackWithKey returns the stack trace of the caller of CancelWithCauseAndKey that canceled the context, captured by WithCancellerStack.
+// For the cancellation by WithCancelOnError or WithDeferredCancelOnError, it is the stack of the caller of GoWithKey that started the process triggering it.
+// It returns nil if WithCancellerStack is not set or the context is not canceled by CancelWithCauseAndKey (e.g. by the cancel func or the parent).
+func CancellerStackWithKey(ctx context.Context, key any) []byte {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return nil
+	}
+	dg.mu.Lock()
+	defer dg.mu.Unlock()
+	return dg.cancellerStack
+}
+
+// FormatShutdown returns a human-readable summary of the shutdown of the doneGroup for logging (e.g. at the end of main after Wait).
+// It reports the cancellation cause, the number of the executed and failed cleanup functions with their names (CleanupWithName) and errors, and the duration from the cancellation to the last finished cleanup function.
+// It only reads the state already collected, and covers the cleanup functions of the doneGroup itself (not of the descendants).
+func FormatShutdown(ctx context.Context) string {
+	return FormatShutdownWithKey(ctx, doneGroupKey)
+}
+
+// FormatShutdownWithKey returns a human-readable summary of the shutdown of the doneGroup for logging (e.g. at the end of main after WaitWithKey).
+// It reports the cancellation cause, the number of the executed and failed cleanup functions with their names (CleanupWithNameAndKey) and errors, and the duration from the cancellation to the last finished cleanup function.
+// It only reads the state already collected, and covers the cleanup functions of the doneGroup itself (not of the descendants).
+func FormatShutdownWithKey(ctx context.Context, key any) string {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return ErrNotContainDoneGroup.Error()
+	}
+	dg.mu.Lock()
+	defer dg.mu.Unlock()
+	var b strings.Builder
+	b.WriteString("donegroup: shutdown summary\n")
+	if ctx.Err() == nil {
+		b.WriteString("  cause: not canceled\n")
+	} else {
+		fmt.Fprintf(&b, "  cause: %s\n", causeString(context.Cause(ctx)))
+	}
+	fmt.Fprintf(&b, "  cleanups: %d registered, %d executed, %d failed\n", dg.registered, dg.executed, len(dg.failures))
+	for _, f := range dg.failures {
+		name := f.name
+		if name == "" {
+			name = "(unnamed)"
+		}
+		fmt.Fprintf(&b, "    %s: %v\n", name, f.err)
+	}
+	duration := time.Duration(0)
+	if !dg.canceledAt.IsZero() && dg.finishedAt.After(dg.canceledAt) {
+		duration = dg.finishedAt.Sub(dg.canceledAt)
+	}
+	fmt.Fprintf(&b, "  duration: %s", duration)
+	return b.String()
+}
+
+// DoneGroupKeys returns the keys of the doneGroups on the context (including the default key used by the functions without key), in the order of installation.
+// Only the keys installed by the functions of donegroup (With* and *WithKey) are discoverable. It returns an empty slice for a context without doneGroups.
+// It lets generic shutdown code drain every doneGroup on the context without knowing the keys in advance.
+func DoneGroupKeys(ctx context.Context) []any {
+	keys, _ := ctx.Value(doneGroupKeysKey{}).([]any)
+	found := make([]any, 0, len(keys))
+	for _, key := range keys {
+		// The doneGroup may be hidden by WithoutCancelWithKey
+		if _, ok := ctx.Value(key).(*doneGroup); ok {
+			found = append(found, key)
+		}
+	}
+	return found
+}
+
+// SinceCancel returns the time elapsed since the context was canceled (e.g. for progress logging like "shutting down, 3.2s elapsed").
+// It returns false if the context is not canceled yet or does not contain a doneGroup.
+func SinceCancel(ctx context.Context) (time.Duration, bool) {
+	return SinceCancelWithKey(ctx, doneGroupKey)
+}
+
+// SinceCancelWithKey returns the time elapsed since the context was canceled (e.g. for progress logging like "shutting down, 3.2s elapsed").
+// It returns false if the context is not canceled yet or does not contain a doneGroup.
+func SinceCancelWithKey(ctx context.Context, key any) (time.Duration, bool) {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok || ctx.Err() == nil {
+		return 0, false
+	}
+	return time.Since(dg.canceledTime()), true
+}
+
+// ConfiguredWaitTimeout returns the default wait timeout set by WithWaitTimeout.
+// It returns false if the default wait timeout is not configured.
+func ConfiguredWaitTimeout(ctx context.Context) (time.Duration, bool) {
+	return ConfiguredWaitTimeoutWithKey(ctx, doneGroupKey)
+}
+
+// ConfiguredWaitTimeoutWithKey returns the default wait timeout set by WithWaitTimeout.
+// It returns false if the default wait timeout is not configured.
+func ConfiguredWaitTimeoutWithKey(ctx context.Context, key any) (time.Duration, bool) {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok || dg.config.waitTimeout <= 0 {
+		return 0, false
+	}
+	return dg.config.waitTimeout, true
+}
@@ -0,0 +1,611 @@
+package donegroup
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInspect(t *testing.T) {
+	t.Parallel()
+	errTest := errors.New("test error")
+	rootCtx, _ := WithCancel(context.Background())
+	leafCtx, _ := WithCancel(rootCtx)
+	for i := 0; i < 3; i++ {
+		if err := Cleanup(rootCtx, func() error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	{
+		info, err := Inspect(rootCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := Info{CleanupGroups: 2, Cleanups: 3, Pending: 3}
+		if *info != want {
+			t.Errorf("got %+v, want %+v", *info, want)
+		}
+	}
+
+	{
+		info, err := Inspect(leafCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := Info{CleanupGroups: 1, Depth: 1}
+		if *info != want {
+			t.Errorf("got %+v, want %+v", *info, want)
+		}
+	}
+
+	waiting := make(chan struct{})
+	go func() {
+		for {
+			info, err := Inspect(rootCtx)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if info.Waiting {
+				close(waiting)
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	done := make(chan struct{})
+	go func() {
+		_ = Wait(rootCtx)
+		close(done)
+	}()
+	<-waiting
+	if err := CancelWithCause(rootCtx, errTest); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	info, err := Inspect(rootCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Waiting {
+		t.Error("expected not waiting")
+	}
+	if !info.Canceled {
+		t.Error("expected canceled")
+	}
+	if !errors.Is(info.Cause, errTest) {
+		t.Errorf("got %v, want %v", info.Cause, errTest)
+	}
+	if info.Pending != 0 {
+		t.Errorf("got %d, want %d", info.Pending, 0)
+	}
+
+	if _, err := Inspect(context.Background()); !errors.Is(err, ErrNotContainDoneGroup) {
+		t.Errorf("expected ErrNotContainDoneGroup, got %v", err)
+	}
+}
+
+func TestInfoString(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		info Info
+		want string
+	}{
+		{Info{Cleanups: 3, Pending: 3}, "donegroup: 3 registered, 3 pending, not canceled, depth=0"},
+		{Info{Cleanups: 3, Pending: 1, Canceled: true, Cause: context.DeadlineExceeded, Depth: 2}, "donegroup: 3 registered, 1 pending, canceled(cause=context.DeadlineExceeded), depth=2"},
+		{Info{Cleanups: 1, Pending: 1, Canceled: true, Cause: errors.New("test error"), Waiting: true, Depth: 1}, "donegroup: 1 registered, 1 pending, canceled(cause=test error), waiting, depth=1"},
+	}
+	for _, tt := range tests {
+		if got := tt.info.String(); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestDepth(t *testing.T) {
+	t.Parallel()
+	rootCtx, cancel := WithCancel(context.Background())
+	defer cancel()
+	secondCtx, _ := WithCancel(rootCtx)
+	thirdCtx, thirdCancel := context.WithCancel(secondCtx) // context.WithCancel
+	defer thirdCancel()
+	fourthCtx, _ := WithTimeout(thirdCtx, time.Second)
+	otherKeyCtx, _ := WithCancelWithKey(fourthCtx, "other")
+
+	tests := []struct {
+		ctx  context.Context
+		key  any
+		want int
+	}{
+		{rootCtx, doneGroupKey, 0},
+		{secondCtx, doneGroupKey, 1},
+		{thirdCtx, doneGroupKey, 1},
+		{fourthCtx, doneGroupKey, 2},
+		{otherKeyCtx, doneGroupKey, 2},
+		{otherKeyCtx, "other", 0},
+	}
+	for _, tt := range tests {
+		got, err := DepthWithKey(tt.ctx, tt.key)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("got %d, want %d", got, tt.want)
+		}
+	}
+
+	if _, err := Depth(context.Background()); !errors.Is(err, ErrNotContainDoneGroup) {
+		t.Errorf("expected ErrNotContainDoneGroup, got %v", err)
+	}
+}
+
+func TestTags(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background())
+	for i := 0; i < 3; i++ {
+		if err := CleanupTagged(ctx, "db-conn", func() error {
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := CleanupTagged(ctx, "file", func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := Cleanup(ctx, func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	{
+		tags, err := Tags(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tags) != 2 {
+			t.Errorf("got %d tags, want 2", len(tags))
+		}
+		if want := (TagStats{Cleanups: 3, Pending: 3}); tags["db-conn"] != want {
+			t.Errorf("got %+v, want %+v", tags["db-conn"], want)
+		}
+	}
+
+	cancel()
+	if err := Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	tags, err := Tags(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := tags["db-conn"]
+	if db.Cleanups != 3 || db.Pending != 0 {
+		t.Errorf("got %+v, want 3 cleanups and 0 pending", db)
+	}
+	if db.Duration < 30*time.Millisecond {
+		t.Errorf("got %v, want >= %v", db.Duration, 30*time.Millisecond)
+	}
+	if file := tags["file"]; file.Cleanups != 1 || file.Pending != 0 {
+		t.Errorf("got %+v, want 1 cleanup and 0 pending", file)
+	}
+
+	if _, err := Tags(context.Background()); !errors.Is(err, ErrNotContainDoneGroup) {
+		t.Errorf("got %v, want %v", err, ErrNotContainDoneGroup)
+	}
+}
+
+func TestConfiguredWaitTimeout(t *testing.T) {
+	t.Parallel()
+	rootCtx, _ := WithCancel(context.Background(), WithWaitTimeout(time.Second))
+	leafCtx, _ := WithCancel(rootCtx, WithWaitTimeout(10*time.Millisecond))
+	otherCtx, _ := WithCancel(context.Background())
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		want   time.Duration
+		wantOK bool
+	}{
+		{"root", rootCtx, time.Second, true},
+		{"leaf overrides", leafCtx, 10 * time.Millisecond, true},
+		{"not configured", otherCtx, 0, false},
+		{"no doneGroup", context.Background(), 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ConfiguredWaitTimeout(tt.ctx)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("got (%v, %v), want (%v, %v)", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestInspectCanceledByAncestor(t *testing.T) {
+	t.Parallel()
+	errParent := errors.New("parent cause")
+	errChild := errors.New("child cause")
+	tests := []struct {
+		name   string
+		cancel func(parent, child context.CancelCauseFunc)
+		want   bool
+	}{
+		{"not canceled", func(parent, child context.CancelCauseFunc) {}, false},
+		{"canceled by own cancel", func(parent, child context.CancelCauseFunc) { child(errChild) }, false},
+		{"canceled by ancestor", func(parent, child context.CancelCauseFunc) { parent(errParent) }, true},
+		{"canceled by own cancel before ancestor", func(parent, child context.CancelCauseFunc) {
+			child(errChild)
+			parent(errParent)
+		}, false},
+		{"canceled by own plain cancel before ancestor", func(parent, child context.CancelCauseFunc) {
+			child(nil)
+			parent(nil)
+		}, false},
+		{"canceled by own cancel after ancestor", func(parent, child context.CancelCauseFunc) {
+			parent(nil)
+			child(nil)
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			rootCtx, rootCancel := WithCancelCause(context.Background())
+			midCtx, _ := WithCancel(rootCtx)
+			leafCtx, leafCancel := WithCancelCause(midCtx)
+			tt.cancel(rootCancel, leafCancel)
+			info, err := Inspect(leafCtx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.CanceledByAncestor != tt.want {
+				t.Errorf("got %v, want %v", info.CanceledByAncestor, tt.want)
+			}
+		})
+	}
+	t.Run("canceled by own deadline", func(t *testing.T) {
+		t.Parallel()
+		rootCtx, rootCancel := WithCancel(context.Background())
+		defer rootCancel()
+		leafCtx, leafCancel := WithTimeout(rootCtx, time.Millisecond)
+		defer leafCancel()
+		<-leafCtx.Done()
+		rootCancel()
+		info, err := Inspect(leafCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.CanceledByAncestor {
+			t.Error("got true, want false")
+		}
+	})
+}
+
+func TestRegistrationTimes(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background())
+	defer cancel()
+	before := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := Cleanup(ctx, func() error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	got, err := RegistrationTimes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("got %d registration times, want 3", len(got))
+	}
+	if got[0].Before(before) {
+		t.Errorf("got %v, want after %v", got[0], before)
+	}
+	for i := 1; i < len(got); i++ {
+		if !got[i-1].Before(got[i]) {
+			t.Errorf("registration times are not in the order of registration: %v", got)
+		}
+	}
+	if _, err := RegistrationTimes(context.Background()); !errors.Is(err, ErrNotContainDoneGroup) {
+		t.Errorf("got %v, want %v", err, ErrNotContainDoneGroup)
+	}
+}
+
+func TestActiveGoroutines(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background())
+	leafCtx, _ := WithCancel(ctx)
+	release := make(chan struct{})
+	for _, c := range []context.Context{ctx, leafCtx} {
+		if err := Cleanup(c, func() error {
+			<-release
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		Go(c, func() error {
+			<-release
+			return nil
+		})
+	}
+	if got := ActiveGoroutines(ctx); got != 2 {
+		t.Errorf("got %d, want 2", got)
+	}
+	cancel()
+	for ActiveGoroutines(ctx) != 4 {
+		time.Sleep(time.Millisecond)
+	}
+	if got := ActiveGoroutines(leafCtx); got != 2 {
+		t.Errorf("got %d, want 2", got)
+	}
+	close(release)
+	if err := Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := ActiveGoroutines(ctx); got != 0 {
+		t.Errorf("got %d, want 0", got)
+	}
+	if got := ActiveGoroutines(context.Background()); got != 0 {
+		t.Errorf("got %d, want 0", got)
+	}
+}
+
+func TestRunningCleanups(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background())
+	child, _ := WithCancel(ctx)
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	stuck := func() error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}
+	if err := CleanupWithName(ctx, "db-flush", stuck); err != nil {
+		t.Fatal(err)
+	}
+	if err := CleanupWithName(child, "cache", stuck); err != nil {
+		t.Fatal(err)
+	}
+	if err := CleanupWithName(ctx, "quick", func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	names, err := RunningCleanups(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 0 {
+		t.Errorf("got %v, want empty before the cancellation", names)
+	}
+	cancel()
+	<-started
+	<-started
+	// Wait for the quick cleanup function to finish
+	for {
+		info, err := Inspect(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Pending == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	names, err = RunningCleanups(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"cache", "db-flush"}; !slices.Equal(names, want) {
+		t.Errorf("got %v, want %v", names, want)
+	}
+	close(release)
+	if err := Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	names, err = RunningCleanups(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 0 {
+		t.Errorf("got %v, want empty after Wait", names)
+	}
+}
+
+func TestRegistrationIsRegistered(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background(), WithMaxConcurrentCleanups(1))
+	started := make(chan struct{})
+	release := make(chan struct{})
+	first, err := CleanupWithRegistration(ctx, func() error {
+		close(started)
+		<-release
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The registrations of the same (unnamed) function are distinguished by the handle
+	second, err := CleanupWithRegistration(ctx, func() error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.IsRegistered() || !second.IsRegistered() {
+		t.Error("both should be registered")
+	}
+	cancel()
+	<-started
+	if first.IsRegistered() {
+		t.Error("first should not be registered after it starts")
+	}
+	if !second.IsRegistered() {
+		t.Error("second should be registered until it starts")
+	}
+	close(release)
+	if err := Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if second.IsRegistered() {
+		t.Error("second should not be registered after it runs")
+	}
+
+	t.Run("Discarded", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := WithCancel(context.Background())
+		defer cancel()
+		r, err := CleanupWithRegistration(ctx, func() error { return nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Discard(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if r.IsRegistered() {
+			t.Error("should not be registered after it is discarded")
+		}
+	})
+
+	t.Run("Without WithCancel", func(t *testing.T) {
+		t.Parallel()
+		if _, err := CleanupWithRegistration(context.Background(), func() error { return nil }); !errors.Is(err, ErrNotContainDoneGroup) {
+			t.Errorf("got %v, want %v", err, ErrNotContainDoneGroup)
+		}
+	})
+}
+
+func TestCancellerStack(t *testing.T) {
+	t.Parallel()
+	ctx, _ := WithCancel(context.Background(), WithCancellerStack())
+	if got := CancellerStack(ctx); got != nil {
+		t.Errorf("got %s, want nil", got)
+	}
+	shutdownByHealthCheck := func() {
+		if err := CancelWithCause(ctx, errors.New("unhealthy")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	shutdownByHealthCheck()
+	if got, want := string(CancellerStack(ctx)), "TestCancellerStack.func1"; !strings.Contains(got, want) {
+		t.Errorf("got %q, want to contain %q", got, want)
+	}
+	if err := Wait(ctx); err != nil {
+		t.Error(err)
+	}
+
+	t.Run("WithCancelOnError", func(t *testing.T) {
+		t.Parallel()
+		ctx, _ := WithCancel(context.Background(), WithCancellerStack(), WithCancelOnError())
+		startWorker := func() {
+			Go(ctx, func() error {
+				return errors.New("worker failed")
+			})
+		}
+		startWorker()
+		<-ctx.Done()
+		if got, want := string(CancellerStack(ctx)), "TestCancellerStack.func2.1"; !strings.Contains(got, want) {
+			t.Errorf("got %q, want to contain %q", got, want)
+		}
+		if err := CancelWithCause(ctx, errors.New("unhealthy")); !errors.Is(err, ErrAlreadyCanceled) {
+			t.Errorf("got %v, want %v", err, ErrAlreadyCanceled)
+		}
+		if err := Wait(ctx); err == nil {
+			t.Error("want error")
+		}
+	})
+
+	t.Run("Without WithCancellerStack", func(t *testing.T) {
+		t.Parallel()
+		ctx, _ := WithCancel(context.Background())
+		if err := CancelWithCause(ctx, errors.New("unhealthy")); err != nil {
+			t.Fatal(err)
+		}
+		if got := CancellerStack(ctx); got != nil {
+			t.Errorf("got %s, want nil", got)
+		}
+	})
+}
+
+func TestFormatShutdown(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancelCause(context.Background(), WithMaxConcurrentCleanups(1))
+	if err := CleanupWithName(ctx, "db-flush", func() error {
+		return errors.New("flush failed")
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Cleanup(ctx, func() error {
+		return errors.New("close failed")
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := CleanupWithName(ctx, "cache", func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := FormatShutdown(ctx), "  cause: not canceled\n"; !strings.Contains(got, want) {
+		t.Errorf("got %q, want to contain %q", got, want)
+	}
+	cancel(errors.New("SIGTERM"))
+	_ = Wait(ctx)
+	got := FormatShutdown(ctx)
+	want := "donegroup: shutdown summary\n" +
+		"  cause: SIGTERM\n" +
+		"  cleanups: 3 registered, 3 executed, 2 failed\n" +
+		"    db-flush: flush failed\n" +
+		"    (unnamed): close failed\n" +
+		"  duration: "
+	if !strings.HasPrefix(got, want) {
+		t.Errorf("got %q, want prefix %q", got, want)
+	}
+}
+
+func TestDoneGroupKeys(t *testing.T) {
+	t.Parallel()
+	type libKey struct{}
+	if keys := DoneGroupKeys(context.Background()); len(keys) != 0 {
+		t.Errorf("got %v, want empty", keys)
+	}
+	ctx, cancel := WithCancel(context.Background())
+	defer cancel()
+	ctx, cancelLib := WithCancelWithKey(ctx, libKey{})
+	defer cancelLib()
+	child, cancelChild := WithCancel(ctx)
+	defer cancelChild()
+	keys := DoneGroupKeys(child)
+	if len(keys) != 2 || keys[0] != doneGroupKey || keys[1] != (libKey{}) {
+		t.Errorf("got %v, want the default key and libKey", keys)
+	}
+	if keys := DoneGroupKeys(WithoutCancelWithKey(child, libKey{})); len(keys) != 1 || keys[0] != doneGroupKey {
+		t.Errorf("got %v, want only the default key", keys)
+	}
+	// Generic shutdown code can drain every doneGroup
+	cancel()
+	if err := WaitKeysInOrder(ctx, DoneGroupKeys(ctx)...); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSinceCancel(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background())
+	if _, ok := SinceCancel(ctx); ok {
+		t.Error("got true, want false before the cancellation")
+	}
+	cancel()
+	first, ok := SinceCancel(ctx)
+	if !ok {
+		t.Fatal("got false, want true after the cancellation")
+	}
+	time.Sleep(10 * time.Millisecond)
+	elapsed, _ := SinceCancel(ctx)
+	if elapsed-first < 10*time.Millisecond {
+		t.Errorf("got %v, want at least 10ms more than %v", elapsed, first)
+	}
+	if _, ok := SinceCancel(context.Background()); ok {
+		t.Error("got true, want false without a doneGroup")
+	}
+}
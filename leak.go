@@ -0,0 +1,11 @@
+//go:build !donegroup_debug
+
+package donegroup
+
+// leakTracker is a no-op unless built with the donegroup_debug build tag.
+type leakTracker struct{}
+
+func (dg *doneGroup) trackLeak()      {}
+func (dg *doneGroup) leakRegistered() {}
+func (dg *doneGroup) leakCanceled()   {}
+func (dg *doneGroup) leakConsumed()   {}
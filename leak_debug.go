@@ -0,0 +1,44 @@
+//go:build donegroup_debug
+
+package donegroup
+
+import (
+	"log"
+	"runtime"
+	"sync/atomic"
+)
+
+// leakReport reports the doneGroup whose errors are dropped. It is replaced in tests.
+var leakReport = func(msg string) {
+	log.Print(msg)
+}
+
+// leakTracker detects the doneGroup that is garbage collected without consuming the errors of the cleanup functions.
+// It is referenced only by the doneGroup and does not reference it, so its finalizer runs after the doneGroup becomes unreachable.
+type leakTracker struct {
+	registered atomic.Bool
+	canceled   atomic.Bool
+	consumed   atomic.Bool
+}
+
+func (dg *doneGroup) trackLeak() {
+	t := &leakTracker{}
+	runtime.SetFinalizer(t, func(t *leakTracker) {
+		if t.registered.Load() && t.canceled.Load() && !t.consumed.Load() {
+			leakReport("donegroup: the context with cleanup functions was canceled and garbage collected without Wait (or Settled), so the errors of the cleanup functions were dropped")
+		}
+	})
+	dg.leak = t
+}
+
+func (dg *doneGroup) leakRegistered() {
+	dg.leak.registered.Store(true)
+}
+
+func (dg *doneGroup) leakCanceled() {
+	dg.leak.canceled.Store(true)
+}
+
+func (dg *doneGroup) leakConsumed() {
+	dg.leak.consumed.Store(true)
+}
@@ -0,0 +1,49 @@
+//go:build donegroup_debug
+
+package donegroup
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestLeakReport(t *testing.T) {
+	reported := make(chan string, 10)
+	orig := leakReport
+	leakReport = func(msg string) {
+		reported <- msg
+	}
+	t.Cleanup(func() {
+		leakReport = orig
+	})
+
+	func() {
+		ctx, cancel := WithCancel(context.Background())
+		if err := Cleanup(ctx, func() error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		// Not waited
+		time.Sleep(10 * time.Millisecond)
+	}()
+	func() {
+		ctx, cancel := WithCancel(context.Background())
+		if err := Cleanup(ctx, func() error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		if err := Wait(ctx); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := len(reported); got != 1 {
+		t.Errorf("got %d reports, want 1", got)
+	}
+}
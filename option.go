@@ -0,0 +1,317 @@
+package donegroup
+
+import (
+	"context"
+	"runtime"
+	"slices"
+	"time"
+)
+
+// Option is a function that configures a doneGroup.
+type Option func(*config)
+
+type config struct {
+	maxConcurrentCleanups      int
+	exitCoder                  func(ExitStatus) int
+	registrationStacks         bool
+	scheduler                  func(ctx context.Context, f func()) (stop func() bool)
+	repanic                    bool
+	budgetSplitting            bool
+	cancelOnError              bool
+	cleanupMiddlewares         []func(name string, f func() error) func() error
+	waitTimeout                time.Duration
+	causeFromFirstCleanupError bool
+	goErrorFilter              func(error) error
+	cleanupErrorFilter         func(error) error
+	maxCollectedErrors         int
+	lateRegistrationCheck      bool
+	abandonOnWaitTimeout       bool
+	leafFirst                  bool
+	inheritDeadlineForWait     bool
+	deferredCancelDecider      func([]error) bool
+	preCancelBarrier           bool
+	perCleanupTimeout          time.Duration
+	fatalCause                 func(error) bool
+	maxDepth                   int
+	strictMaxDepth             bool
+	cancellerStack             bool
+	heartbeat                  func()
+	heartbeatInterval          time.Duration
+	requiredGoLimit            time.Duration
+}
+
+// CleanupOption is a function that configures a cleanup function registered by Cleanup.
+type CleanupOption func(*cleanup)
+
+// Phase is the phase of shutdown in which the cleanup function is executed. The phases are executed in ascending order.
+// Any value can be used to define an intermediate phase (e.g. PhaseNormal + 10).
+type Phase int
+
+const (
+	// PhaseFirst is the phase executed before PhaseNormal.
+	PhaseFirst Phase = -100
+	// PhaseNormal is the default phase of the cleanup functions.
+	PhaseNormal Phase = 0
+	// PhaseLast is the phase executed after PhaseNormal.
+	PhaseLast Phase = 100
+)
+
+// InPhase sets the phase in which the cleanup function is executed (see CleanupInPhase).
+// Note that the order of the phases is guaranteed within a doneGroup: the cleanup functions of the descendant doneGroups are executed by their own doneGroups.
+func InPhase(phase Phase) CleanupOption {
+	return func(c *cleanup) {
+		c.phase = phase
+	}
+}
+
+// CleanupTimeout sets the timeout of the cleanup function, overriding the default set by WithPerCleanupTimeout (see CleanupWithTimeout).
+// If timeout is negative, the cleanup function has no timeout of its own.
+func CleanupTimeout(timeout time.Duration) CleanupOption {
+	return func(c *cleanup) {
+		c.timeout = timeout
+	}
+}
+
+// IgnoreWaitTimeout makes the cleanup function opt out of the timeout of WaitWithTimeout (and the context of WaitWithContext).
+// The context passed to the function (CleanupWithContext) is not canceled when waiting gives up, and it is not counted as still running in the error.
+// Wait still returns at the timeout, and the function runs to completion. Its error is collected later, and can be retrieved by CollectedErrors.
+func IgnoreWaitTimeout() CleanupOption {
+	return func(c *cleanup) {
+		c.ignoreWaitTimeout = true
+	}
+}
+
+// WithMaxConcurrentCleanups sets the maximum number of cleanup functions executed concurrently.
+// The rest of the cleanup functions are queued and executed in the order of registration.
+// If n is less than or equal to 0, there is no limit (default).
+// If n is 1, the cleanup functions are executed one by one in the order of registration, so the execution order is deterministic.
+// Note that the order is guaranteed within a doneGroup: the cleanup functions of the descendant doneGroups are executed by their own doneGroups.
+func WithMaxConcurrentCleanups(n int) Option {
+	return func(c *config) {
+		c.maxConcurrentCleanups = n
+	}
+}
+
+// WithCPUBoundCleanups executes the cleanup functions on a worker pool sized to runtime.GOMAXPROCS, instead of a goroutine per cleanup function.
+// It is intended for CPU-heavy teardown (e.g. compressing and flushing buffers) to avoid oversubscribing the CPU.
+// It is equivalent to WithMaxConcurrentCleanups(runtime.GOMAXPROCS(0)) evaluated when the option is applied.
+func WithCPUBoundCleanups() Option {
+	return func(c *config) {
+		c.maxConcurrentCleanups = runtime.GOMAXPROCS(0)
+	}
+}
+
+// WithRegistrationStacks enables capturing the stack trace at each registration of Cleanup, Awaiter and Go.
+// The stack traces of the cleanup functions (and processes) still running when waiting times out are included in the error.
+// It is intended for debugging because it adds overhead.
+func WithRegistrationStacks() Option {
+	return func(c *config) {
+		c.registrationStacks = true
+	}
+}
+
+// WithCancellerStack enables capturing the stack trace of the caller of CancelWithCause (and CancelWithCauses, CancelWithExit) that cancels the context.
+// The cancellation by WithCancelOnError and WithDeferredCancelOnError is attributed to the caller of Go that started the failed process.
+// The stack trace is retrieved by CancellerStack to find which code path triggered the shutdown.
+// It is intended for debugging because it adds overhead.
+func WithCancellerStack() Option {
+	return func(c *config) {
+		c.cancellerStack = true
+	}
+}
+
+// WithScheduler sets the function to schedule the start of executing the cleanup functions when the context is canceled.
+// The function must have the same semantics as context.AfterFunc (default), but may call f at any time (e.g. synchronously in tests).
+// Cleanup functions registered after f is called are executed immediately.
+// The scheduler is not used if the context is already done when the doneGroup is created.
+func WithScheduler(scheduler func(ctx context.Context, f func()) (stop func() bool)) Option {
+	return func(c *config) {
+		c.scheduler = scheduler
+	}
+}
+
+// WithBudgetSplitting enables splitting the remaining time until the deadline of the context (ctxw) of WaitWithContext (or the timeout of WaitWithTimeout) among the pending cleanup functions.
+// Each cleanup function receives a context that is canceled when its own slice of the budget elapses or ctxw is canceled.
+// The slice is calculated when the cleanup function starts, so the budget left unused by cleanup functions that finish early is returned to the rest.
+// It is intended to be used with WithMaxConcurrentCleanups. Cleanup functions that start before Wait is called are not bound by the budget.
+func WithBudgetSplitting() Option {
+	return func(c *config) {
+		c.budgetSplitting = true
+	}
+}
+
+// WithCancelOnError makes the context canceled with the error as the cause when a function called by Go returns a non-nil error.
+// The error is still collected and returned by Wait.
+func WithCancelOnError() Option {
+	return func(c *config) {
+		c.cancelOnError = true
+	}
+}
+
+// WithCleanupMiddleware adds a middleware that wraps every cleanup function registered with the doneGroup.
+// The middleware receives the name of the cleanup function (empty unless registered by CleanupWithName) and the function, and returns the wrapped function.
+// Middlewares are chained in the order they are added: the first added is the outermost, so it runs first before and last after the cleanup function.
+// Middlewares are applied when the cleanup function is executed, and do not apply to processes guarded by Awaiter or Go.
+func WithCleanupMiddleware(mw func(name string, f func() error) func() error) Option {
+	return func(c *config) {
+		c.cleanupMiddlewares = append(slices.Clip(c.cleanupMiddlewares), mw)
+	}
+}
+
+// WithWaitTimeout sets the default timeout of Wait (and Run).
+// Wait with the default timeout behaves like WaitWithTimeout. It does not affect WaitWithTimeout and WaitWithContext.
+// If timeout is less than or equal to 0, there is no timeout (default).
+func WithWaitTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.waitTimeout = timeout
+	}
+}
+
+// WithInheritDeadlineForWait makes Wait (without timeout) give up at the deadline of the context, including the deadline inherited from the ancestor contexts (e.g. a parent created by WithTimeout).
+// So a timed parent bounds the teardown of its descendants.
+// The trade-off: when the deadline itself cancels the context, Wait gives up immediately, and the contexts of the cleanup functions are canceled as soon as they start, leaving them no time.
+// Use it when the context is usually canceled before its deadline (e.g. by a signal), and the deadline is the upper bound of the whole run including the teardown.
+// If the default wait timeout is also set by WithWaitTimeout, the earlier one is used.
+func WithInheritDeadlineForWait() Option {
+	return func(c *config) {
+		c.inheritDeadlineForWait = true
+	}
+}
+
+// WithDeferredCancelOnError makes the context canceled after all the processes started by Go finish, if the decider returns true for their errors.
+// Unlike WithCancelOnError, a single error does not abort the peers: e.g. a decider can escalate only when the majority of the fan-out failed.
+// The decider is called each time the running Go set drains with at least one error, with the errors of the set. The cause is the joined errors.
+// If the decider returns false, the context is not canceled, so Wait (and JoinGoWithProgress) keeps waiting for the cancellation by others.
+func WithDeferredCancelOnError(decider func([]error) bool) Option {
+	return func(c *config) {
+		c.deferredCancelDecider = decider
+	}
+}
+
+// WithPreCancelBarrier makes the cancel func of the context run the functions registered by CleanupPreCancel before actually canceling the context.
+// So the descendant contexts do not see Done until the pre-cancel functions finish (e.g. the parent quiesces a shared resource while the children keep running).
+// Note that it adds the latency of the pre-cancel functions between the cancel request and the observable cancellation, and the cancel func blocks until then.
+// It applies to the cancel funcs returned by WithCancel, WithCancelCause, WithTimeout and WithDeadline, and Cancel (and CancelWithCause).
+// The deadline and the cancellation of the parent context are not delayed: the pre-cancel functions run after the context is canceled, before the cleanup functions, and Wait waits for them and returns their errors.
+// A pre-cancel function must not cancel the context by itself, as it waits for the barrier forever.
+func WithPreCancelBarrier() Option {
+	return func(c *config) {
+		c.preCancelBarrier = true
+	}
+}
+
+// WithHeartbeat makes Wait call f every interval while it is waiting for the cleanup functions after the context is canceled (e.g. to touch a liveness file),
+// so the orchestrator does not kill the process that is legitimately draining.
+// f is called from a single goroutine per Wait, and is not called after Wait returns (including when the wait times out).
+// f should return quickly because Wait returns after the running call of f finishes.
+func WithHeartbeat(interval time.Duration, f func()) Option {
+	return func(c *config) {
+		c.heartbeatInterval = interval
+		c.heartbeat = f
+	}
+}
+
+// WithRequiredGoLimit sets the hard limit of waiting for the processes started by GoRequired after the timeout of WaitWithTimeout has passed.
+// The processes started by Go are abandoned at the timeout, and the required ones are waited for up to limit more.
+// Default is no limit: Wait waits until the required processes finish.
+func WithRequiredGoLimit(limit time.Duration) Option {
+	return func(c *config) {
+		c.requiredGoLimit = limit
+	}
+}
+
+// WithPerCleanupTimeout sets the default timeout of each cleanup function, so one slow cleanup function does not consume the whole budget of the wait.
+// The context passed to the cleanup function (CleanupWithContext) is canceled when the timeout has passed,
+// and the timeout is recorded as an error wrapping context.DeadlineExceeded without aborting the other cleanup functions.
+// It can be overridden per registration by CleanupWithTimeout (or CleanupTimeout).
+func WithPerCleanupTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.perCleanupTimeout = timeout
+	}
+}
+
+// WithCauseFromFirstCleanupError makes FinalCause return the first error of the cleanup functions if the context was canceled without a cause.
+// It does not change context.Cause of the context, which is immutable after the cancellation.
+func WithCauseFromFirstCleanupError() Option {
+	return func(c *config) {
+		c.causeFromFirstCleanupError = true
+	}
+}
+
+// WithGoErrorFilter sets the function to transform the error returned by each process started by Go before it is collected.
+// If the function returns nil, the error is not collected (e.g. to ignore context.Canceled on normal shutdown).
+func WithGoErrorFilter(filter func(error) error) Option {
+	return func(c *config) {
+		c.goErrorFilter = filter
+	}
+}
+
+// WithCleanupErrorFilter sets the function to transform the error returned by each cleanup function before it is collected.
+// If the function returns nil, the error is not collected (e.g. to ignore context.Canceled on normal shutdown).
+func WithCleanupErrorFilter(filter func(error) error) Option {
+	return func(c *config) {
+		c.cleanupErrorFilter = filter
+	}
+}
+
+// WithMaxCollectedErrors sets the maximum number of errors collected by the doneGroup (errors of Cleanup and Go).
+// The first n errors are retained and the rest are counted, and the aggregated error notes the number of the elided errors.
+// It bounds the memory for a long-lived context with processes failing repeatedly.
+// If n is less than or equal to 0, there is no limit (default).
+func WithMaxCollectedErrors(n int) Option {
+	return func(c *config) {
+		c.maxCollectedErrors = n
+	}
+}
+
+// WithAbandonOnWaitTimeout makes the doneGroup stop collecting the errors after Wait gives up by the timeout of WaitWithTimeout (or the context of WaitWithContext).
+// By default, the doneGroup keeps collecting the errors of the cleanup functions (and Go) that finish after that, and they can be retrieved by CollectedErrors.
+// With this option, they are discarded, and CollectedErrors (and a subsequent Wait) returns only the errors collected until the wait gave up.
+func WithAbandonOnWaitTimeout() Option {
+	return func(c *config) {
+		c.abandonOnWaitTimeout = true
+	}
+}
+
+// WithLeafFirst makes the cleanup functions of the doneGroup start after the cleanup functions (and the processes guarded by Awaiter and Go) of the descendant doneGroups finish.
+// When the tree is drained, the levels are executed from the leaves to the root, so the ancestors are torn down after the descendants depending on them.
+// It trades the latency of the ancestors for the ordering: a cleanup function of the root does not start until all the cleanup functions and the processes of the descendants finish
+// (see BenchmarkWaitTree for the latency from the cancellation to the start of the root cleanup function). If waiting times out before that, it never starts.
+// So it does not make the critical cleanup functions of an ancestor finish earlier; use it only when the order matters.
+// By default, the cleanup functions of all the doneGroups start simultaneously when they are canceled.
+// It is inherited by the descendant doneGroups. The phases (CleanupInPhase) and WithMaxConcurrentCleanups apply within each doneGroup.
+// Note that a cleanup function of a descendant that waits for a cleanup function of an ancestor never finishes.
+func WithLeafFirst() Option {
+	return func(c *config) {
+		c.leafFirst = true
+	}
+}
+
+// WithMaxDepth makes WithCancel log a warning when the doneGroup is nested deeper than depth (the root doneGroup is 0).
+// Nesting a doneGroup by WithCancel on a donegroup context is intended, but applying it repeatedly by mistake (e.g. in a middleware applied twice) silently multiplies the cleanup groups.
+// It is inherited by the descendant doneGroups. It is intended for debugging, and the default is permissive.
+func WithMaxDepth(depth int) Option {
+	return func(c *config) {
+		c.maxDepth = depth
+		c.strictMaxDepth = false
+	}
+}
+
+// WithStrictMaxDepth makes Cleanup return ErrMaxDepthExceeded when the doneGroup is nested deeper than depth (the root doneGroup is 0), instead of logging like WithMaxDepth.
+// The cleanup function is still registered and called. It is inherited by the descendant doneGroups.
+func WithStrictMaxDepth(depth int) Option {
+	return func(c *config) {
+		c.maxDepth = depth
+		c.strictMaxDepth = true
+	}
+}
+
+// WithLateRegistrationCheck makes Cleanup return ErrLateRegistration when a cleanup function is registered too late to be waited for by Wait:
+// after Wait has returned (or given up), or while Wait is returning because all the cleanup functions have finished.
+// Registering from a running cleanup function is safe and is not reported. The late cleanup function is still registered and called.
+// It is intended for debugging the "my late-registered cleanup didn't run" bug.
+func WithLateRegistrationCheck() Option {
+	return func(c *config) {
+		c.lateRegistrationCheck = true
+	}
+}
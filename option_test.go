@@ -0,0 +1,959 @@
+package donegroup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithMaxConcurrentCleanups(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		n    int
+		want int64
+	}{
+		{"unlimited", 0, 10},
+		{"limit 1", 1, 1},
+		{"limit 3", 3, 3},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := WithCancel(context.Background(), WithMaxConcurrentCleanups(tt.n))
+			errTest := errors.New("test error")
+			var (
+				running atomic.Int64
+				max     atomic.Int64
+				called  atomic.Int64
+			)
+			for i := 0; i < 10; i++ {
+				if err := Cleanup(ctx, func() error {
+					n := running.Add(1)
+					for {
+						m := max.Load()
+						if n <= m || max.CompareAndSwap(m, n) {
+							break
+						}
+					}
+					time.Sleep(10 * time.Millisecond)
+					running.Add(-1)
+					called.Add(1)
+					return errTest
+				}); err != nil {
+					t.Error(err)
+				}
+			}
+			cancel()
+			err := Wait(ctx)
+			if !errors.Is(err, errTest) {
+				t.Errorf("got %v, want %v", err, errTest)
+			}
+			if got := called.Load(); got != 10 {
+				t.Errorf("got %d, want %d", got, 10)
+			}
+			if got := max.Load(); got != tt.want {
+				t.Errorf("got max concurrency %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("Awaiter does not occupy a worker", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := WithCancel(context.Background(), WithMaxConcurrentCleanups(1))
+		completed, err := Awaiter(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cleanup := atomic.Bool{}
+		if err := Cleanup(ctx, func() error {
+			cleanup.Store(true)
+			completed()
+			return nil
+		}); err != nil {
+			t.Error(err)
+		}
+		cancel()
+		if err := WaitWithTimeout(ctx, time.Second); err != nil {
+			t.Error(err)
+		}
+		if !cleanup.Load() {
+			t.Error("cleanup function not called")
+		}
+	})
+
+	t.Run("Inherited by child", func(t *testing.T) {
+		t.Parallel()
+		rootCtx, rootCancel := WithCancel(context.Background(), WithMaxConcurrentCleanups(1))
+		leafCtx, _ := WithCancel(rootCtx)
+		var (
+			running atomic.Int64
+			max     atomic.Int64
+		)
+		for i := 0; i < 3; i++ {
+			if err := Cleanup(leafCtx, func() error {
+				n := running.Add(1)
+				if n > max.Load() {
+					max.Store(n)
+				}
+				time.Sleep(5 * time.Millisecond)
+				running.Add(-1)
+				return nil
+			}); err != nil {
+				t.Error(err)
+			}
+		}
+		rootCancel()
+		if err := Wait(rootCtx); err != nil {
+			t.Error(err)
+		}
+		if got := max.Load(); got != 1 {
+			t.Errorf("got max concurrency %d, want %d", got, 1)
+		}
+	})
+}
+
+func TestWithMaxConcurrentCleanupsOrder(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background(), WithMaxConcurrentCleanups(1))
+	var (
+		mu    sync.Mutex
+		order []int
+	)
+	want := make([]int, 20)
+	for i := range want {
+		want[i] = i
+		if err := Cleanup(ctx, func() error {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, i)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cancel()
+	if err := Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(order, want) {
+		t.Errorf("got %v, want %v", order, want)
+	}
+}
+
+func TestWithRegistrationStacks(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background(), WithRegistrationStacks())
+	release := make(chan struct{})
+	defer close(release)
+	if err := Cleanup(ctx, func() error {
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Cleanup(ctx, func() error {
+		<-release
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	Go(ctx, func() error {
+		<-release
+		return nil
+	})
+	cancel()
+	err := WaitWithTimeout(ctx, 10*time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected timeout error: %v", err)
+	}
+	got := err.Error()
+	if want := "TestWithRegistrationStacks"; strings.Count(got, want) != 2 {
+		t.Errorf("got %q, want 2 stacks containing %q", got, want)
+	}
+	if strings.Contains(got, "donegroup.go") {
+		t.Errorf("got %q, want stacks without donegroup internals", got)
+	}
+}
+
+func TestWithScheduler(t *testing.T) {
+	t.Parallel()
+	var start func()
+	ctx, cancel := WithCancel(context.Background(), WithScheduler(func(ctx context.Context, f func()) func() bool {
+		start = f
+		return func() bool { return false }
+	}))
+	cleanup := atomic.Bool{}
+	if err := Cleanup(ctx, func() error {
+		cleanup.Store(true)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	if cleanup.Load() {
+		t.Error("cleanup function called before scheduled")
+	}
+	start()
+	if err := Wait(ctx); err != nil {
+		t.Error(err)
+	}
+	if !cleanup.Load() {
+		t.Error("cleanup function not called")
+	}
+}
+
+func TestWithBudgetSplitting(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background(), WithMaxConcurrentCleanups(1), WithBudgetSplitting())
+	budgets := make(chan time.Duration, 3)
+	// The first cleanup finishes early, so the rest get more budget.
+	if err := CleanupWithContext(ctx, func(ctx context.Context) error {
+		d, _ := ctx.Deadline()
+		budgets <- time.Until(d)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// The second cleanup uses up its budget.
+	if err := CleanupWithContext(ctx, func(ctx context.Context) error {
+		d, _ := ctx.Deadline()
+		budgets <- time.Until(d)
+		<-ctx.Done()
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := CleanupWithContext(ctx, func(ctx context.Context) error {
+		d, _ := ctx.Deadline()
+		budgets <- time.Until(d)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	ctxw, cancelw := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancelw()
+	done := make(chan error)
+	go func() {
+		done <- WaitWithContext(ctx, ctxw)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	close(budgets)
+	var got []time.Duration
+	for b := range budgets {
+		got = append(got, b)
+	}
+	if len(got) != 3 {
+		t.Fatalf("got %d budgets, want %d", len(got), 3)
+	}
+	// 290ms / 3, 290ms / 2, and the rest
+	if got[0] > 110*time.Millisecond || got[0] < 70*time.Millisecond {
+		t.Errorf("got %v for the first cleanup", got[0])
+	}
+	if got[1] > 160*time.Millisecond || got[1] < 110*time.Millisecond {
+		t.Errorf("got %v for the second cleanup", got[1])
+	}
+	if got[2] > 160*time.Millisecond || got[2] < 110*time.Millisecond {
+		t.Errorf("got %v for the third cleanup", got[2])
+	}
+}
+
+func TestWithCancelOnError(t *testing.T) {
+	t.Parallel()
+	errTest := errors.New("test error")
+	ctx, cancel := WithCancel(context.Background(), WithCancelOnError())
+	defer cancel()
+	stopped := atomic.Bool{}
+	Go(ctx, func() error {
+		<-ctx.Done()
+		stopped.Store(true)
+		return nil
+	})
+	Go(ctx, func() error {
+		return errTest
+	})
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("context not canceled")
+	}
+	if !errors.Is(context.Cause(ctx), errTest) {
+		t.Errorf("got %v, want %v", context.Cause(ctx), errTest)
+	}
+	if err := Wait(ctx); !errors.Is(err, errTest) {
+		t.Errorf("got %v, want %v", err, errTest)
+	}
+	if !stopped.Load() {
+		t.Error("other task not stopped")
+	}
+}
+
+func TestWithCleanupMiddleware(t *testing.T) {
+	t.Parallel()
+	var (
+		mu   sync.Mutex
+		logs []string
+	)
+	logf := func(s string) {
+		mu.Lock()
+		defer mu.Unlock()
+		logs = append(logs, s)
+	}
+	mw := func(id string) func(name string, f func() error) func() error {
+		return func(name string, f func() error) func() error {
+			return func() error {
+				logf(id + " before " + name)
+				err := f()
+				logf(id + " after " + name)
+				return err
+			}
+		}
+	}
+	rootCtx, rootCancel := WithCancel(context.Background(), WithCleanupMiddleware(mw("mw1")))
+	ctx, _ := WithCancel(rootCtx, WithCleanupMiddleware(mw("mw2")))
+	// The middleware of the child is not added to the parent
+	otherCtx, _ := WithCancel(rootCtx)
+	if err := CleanupWithName(ctx, "db", func() error {
+		logf("cleanup db")
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	rootCancel()
+	if err := Wait(rootCtx); err != nil {
+		t.Error(err)
+	}
+	want := []string{"mw1 before db", "mw2 before db", "cleanup db", "mw2 after db", "mw1 after db"}
+	if !slices.Equal(logs, want) {
+		t.Errorf("got %v, want %v", logs, want)
+	}
+
+	logs = nil
+	if err := Cleanup(otherCtx, func() error {
+		logf("cleanup")
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Wait(otherCtx); err != nil {
+		t.Error(err)
+	}
+	want = []string{"mw1 before ", "cleanup", "mw1 after "}
+	if !slices.Equal(logs, want) {
+		t.Errorf("got %v, want %v", logs, want)
+	}
+}
+
+func TestWithCauseFromFirstCleanupError(t *testing.T) {
+	t.Parallel()
+	errCleanup := errors.New("cleanup error")
+	errCause := errors.New("cause")
+	tests := []struct {
+		name      string
+		opts      []Option
+		cause     error
+		want      error
+		wantCause error
+	}{
+		{"without option", nil, nil, context.Canceled, context.Canceled},
+		{"with option", []Option{WithCauseFromFirstCleanupError()}, nil, errCleanup, context.Canceled},
+		{"with option and cause", []Option{WithCauseFromFirstCleanupError()}, errCause, errCause, errCause},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := WithCancelCause(context.Background(), tt.opts...)
+			if err := Cleanup(ctx, func() error { return errCleanup }); err != nil {
+				t.Fatal(err)
+			}
+			cancel(tt.cause)
+			if err := Wait(ctx); !errors.Is(err, errCleanup) {
+				t.Errorf("got %v, want %v", err, errCleanup)
+			}
+			if got := FinalCause(ctx); !errors.Is(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if got := context.Cause(ctx); !errors.Is(got, tt.wantCause) {
+				t.Errorf("got %v, want %v", got, tt.wantCause)
+			}
+		})
+	}
+}
+
+func TestWithErrorFilter(t *testing.T) {
+	t.Parallel()
+	errTest := errors.New("test error")
+	ignoreCanceled := func(err error) error {
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		return err
+	}
+	ctx, cancel := WithCancel(context.Background(), WithGoErrorFilter(ignoreCanceled), WithCleanupErrorFilter(ignoreCanceled))
+	Go(ctx, func() error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	Go(ctx, func() error {
+		return errTest
+	})
+	if err := Cleanup(ctx, func() error {
+		return context.Canceled
+	}); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	err := Wait(ctx)
+	if !errors.Is(err, errTest) {
+		t.Errorf("got %v, want %v", err, errTest)
+	}
+	if errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled to be filtered", err)
+	}
+}
+
+func TestWithMaxCollectedErrors(t *testing.T) {
+	t.Parallel()
+	// Execute the cleanup functions one by one to keep the order of the errors
+	ctx, cancel := WithCancel(context.Background(), WithMaxCollectedErrors(2), WithMaxConcurrentCleanups(1))
+	errs := make([]error, 5)
+	for i := range errs {
+		errs[i] = fmt.Errorf("error %d", i)
+		if err := Cleanup(ctx, func() error {
+			return errs[i]
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cancel()
+	err := Wait(ctx)
+	for i, e := range errs {
+		if got, want := errors.Is(err, e), i < 2; got != want {
+			t.Errorf("errors.Is(err, %v) = %v, want %v", e, got, want)
+		}
+	}
+	if !strings.Contains(err.Error(), "donegroup: 3 errors elided") {
+		t.Errorf("got %v, want the number of the elided errors", err)
+	}
+}
+
+func TestIgnoreWaitTimeout(t *testing.T) {
+	t.Parallel()
+	errTest := errors.New("test error")
+	ctx, cancel := WithCancel(context.Background(), WithRegistrationStacks())
+	if err := CleanupWithContext(ctx, func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+		return errTest
+	}, IgnoreWaitTimeout()); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	err := WaitWithTimeout(ctx, 10*time.Millisecond)
+	if !errors.Is(err, ErrWaitTimeout) {
+		t.Errorf("got %v, want %v", err, ErrWaitTimeout)
+	}
+	if strings.Contains(err.Error(), "still running") {
+		t.Errorf("got %v, want the cleanup function not to be reported as still running", err)
+	}
+	// The cleanup function still runs to completion after the timed-out wait
+	<-Settled(ctx)
+	errs, err := CollectedErrors(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(errors.Join(errs...), errTest) {
+		t.Errorf("got %v, want %v", errs, errTest)
+	}
+}
+
+func TestWithLateRegistrationCheck(t *testing.T) {
+	t.Parallel()
+	t.Run("Late registration is reported", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := WithCancel(context.Background(), WithLateRegistrationCheck())
+		var nested error
+		if err := Cleanup(ctx, func() error {
+			// Registering from a running cleanup function is safe
+			nested = Cleanup(ctx, func() error { return nil })
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		if err := Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if nested != nil {
+			t.Errorf("got %v, want nil", nested)
+		}
+		called := make(chan struct{})
+		if err := Cleanup(ctx, func() error {
+			close(called)
+			return nil
+		}); !errors.Is(err, ErrLateRegistration) {
+			t.Errorf("got %v, want %v", err, ErrLateRegistration)
+		}
+		// The late cleanup function is still called
+		<-called
+	})
+
+	t.Run("Not reported without the option", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := WithCancel(context.Background())
+		cancel()
+		if err := Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if err := Cleanup(ctx, func() error { return nil }); err != nil {
+			t.Errorf("got %v, want nil", err)
+		}
+	})
+}
+
+func TestWithAbandonOnWaitTimeout(t *testing.T) {
+	t.Parallel()
+	errTest := errors.New("test error")
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantErr bool
+	}{
+		{"keep collecting by default", nil, true},
+		{"abandon", []Option{WithAbandonOnWaitTimeout()}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := WithCancel(context.Background(), tt.opts...)
+			if err := Cleanup(ctx, func() error {
+				time.Sleep(50 * time.Millisecond)
+				return errTest
+			}); err != nil {
+				t.Fatal(err)
+			}
+			cancel()
+			if err := WaitWithTimeout(ctx, 10*time.Millisecond); !errors.Is(err, ErrWaitTimeout) {
+				t.Errorf("got %v, want %v", err, ErrWaitTimeout)
+			}
+			<-Settled(ctx)
+			errs, err := CollectedErrors(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !errors.Is(errors.Join(errs...), ErrWaitTimeout) {
+				t.Errorf("got %v, want %v", errs, ErrWaitTimeout)
+			}
+			if got := errors.Is(errors.Join(errs...), errTest); got != tt.wantErr {
+				t.Errorf("got %v, want the late error collected: %v", errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWithLeafFirst(t *testing.T) {
+	t.Parallel()
+	root, cancel := WithCancel(context.Background(), WithLeafFirst())
+	child, _ := WithCancel(root)
+	grandchild, _ := WithCancel(child)
+	var order []string
+	var mu sync.Mutex
+	record := func(name string, d time.Duration) func() error {
+		return func() error {
+			time.Sleep(d)
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, name)
+			return nil
+		}
+	}
+	for _, c := range []struct {
+		ctx  context.Context
+		name string
+		d    time.Duration
+	}{
+		{root, "root", 0},
+		{child, "child", 10 * time.Millisecond},
+		{grandchild, "grandchild", 20 * time.Millisecond},
+	} {
+		if err := Cleanup(c.ctx, record(c.name, c.d)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cancel()
+	if err := Wait(root); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"grandchild", "child", "root"}
+	if !slices.Equal(order, want) {
+		t.Errorf("got %v, want %v", order, want)
+	}
+}
+
+func TestWithInheritDeadlineForWait(t *testing.T) {
+	t.Parallel()
+	parent, cancelParent := WithTimeout(context.Background(), 50*time.Millisecond, WithInheritDeadlineForWait())
+	defer cancelParent()
+	child, cancel := WithCancel(parent)
+	if err := Cleanup(child, func() error {
+		time.Sleep(time.Second)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	start := time.Now()
+	err := Wait(child)
+	if !errors.Is(err, ErrWaitTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want %v", err, ErrWaitTimeout)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("got %v, want the wait bounded by the deadline of the parent", elapsed)
+	}
+}
+
+func TestWithDeferredCancelOnError(t *testing.T) {
+	t.Parallel()
+	errTest := errors.New("test error")
+	majority := func(errs []error) bool {
+		return len(errs) >= 3
+	}
+	tests := []struct {
+		name       string
+		failures   int
+		wantCancel bool
+	}{
+		{"minority failure does not cancel", 1, false},
+		{"majority failure cancels", 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := WithCancel(context.Background(), WithDeferredCancelOnError(majority))
+			defer cancel()
+			release := make(chan struct{})
+			finished := make(chan struct{}, 4)
+			for i := range 4 {
+				Go(ctx, func() error {
+					defer func() { finished <- struct{}{} }()
+					<-release
+					if i < tt.failures {
+						return errTest
+					}
+					return nil
+				})
+			}
+			close(release)
+			for range 4 {
+				<-finished
+			}
+			if tt.wantCancel {
+				<-ctx.Done()
+				if !errors.Is(context.Cause(ctx), errTest) {
+					t.Errorf("got %v, want %v", context.Cause(ctx), errTest)
+				}
+			} else {
+				time.Sleep(10 * time.Millisecond)
+				if ctx.Err() != nil {
+					t.Errorf("got %v, want the context not canceled", context.Cause(ctx))
+				}
+			}
+			cancel()
+			if err := Wait(ctx); !errors.Is(err, errTest) {
+				t.Errorf("got %v, want %v", err, errTest)
+			}
+		})
+	}
+}
+
+func TestWithCPUBoundCleanups(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background(), WithCPUBoundCleanups())
+	limit := int64(runtime.GOMAXPROCS(0))
+	var running, peak atomic.Int64
+	for range 4 * limit {
+		if err := Cleanup(ctx, func() error {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cancel()
+	if err := Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := peak.Load(); got > limit {
+		t.Errorf("got %d concurrent cleanup functions, want at most %d", got, limit)
+	}
+}
+
+func TestWithPreCancelBarrier(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background(), WithPreCancelBarrier())
+	child, _ := WithCancel(ctx)
+	errTest := errors.New("test error")
+	var childLive atomic.Bool
+	if err := CleanupPreCancel(ctx, func() error {
+		time.Sleep(10 * time.Millisecond)
+		childLive.Store(child.Err() == nil)
+		return errTest
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var preCancelFinished atomic.Bool
+	if err := Cleanup(child, func() error {
+		preCancelFinished.Store(childLive.Load())
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if child.Err() == nil {
+		t.Error("child should be canceled after the cancel func returns")
+	}
+	if err := Wait(ctx); !errors.Is(err, errTest) {
+		t.Errorf("got %v, want %v", err, errTest)
+	}
+	if !childLive.Load() {
+		t.Error("child should not see Done during the pre-cancel functions")
+	}
+	if !preCancelFinished.Load() {
+		t.Error("the cleanup function of the child should start after the pre-cancel functions finish")
+	}
+	if err := CleanupPreCancel(ctx, func() error { return nil }); !errors.Is(err, ErrAlreadyCanceled) {
+		t.Errorf("got %v, want %v", err, ErrAlreadyCanceled)
+	}
+
+	t.Run("Cancel func of WithTimeout", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := WithTimeout(context.Background(), time.Hour, WithPreCancelBarrier())
+		var ctxLive atomic.Bool
+		if err := CleanupPreCancel(ctx, func() error {
+			ctxLive.Store(ctx.Err() == nil)
+			return errTest
+		}); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		if err := Wait(ctx); !errors.Is(err, errTest) {
+			t.Errorf("got %v, want %v", err, errTest)
+		}
+		if !ctxLive.Load() {
+			t.Error("the context should not be canceled during the pre-cancel functions")
+		}
+	})
+
+	t.Run("Deadline", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := WithTimeout(context.Background(), 5*time.Millisecond, WithPreCancelBarrier())
+		defer cancel()
+		if err := CleanupPreCancel(ctx, func() error {
+			time.Sleep(10 * time.Millisecond)
+			return errTest
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := Wait(ctx); !errors.Is(err, errTest) {
+			t.Errorf("got %v, want %v", err, errTest)
+		}
+	})
+
+	t.Run("Cancellation of the parent", func(t *testing.T) {
+		t.Parallel()
+		parent, cancelParent := context.WithCancel(context.Background())
+		ctx, cancel := WithCancel(parent, WithPreCancelBarrier())
+		defer cancel()
+		if err := CleanupPreCancel(ctx, func() error {
+			time.Sleep(10 * time.Millisecond)
+			return errTest
+		}); err != nil {
+			t.Fatal(err)
+		}
+		cancelParent()
+		if err := Wait(ctx); !errors.Is(err, errTest) {
+			t.Errorf("got %v, want %v", err, errTest)
+		}
+	})
+
+	t.Run("Without the option", func(t *testing.T) {
+		ctx, cancel := WithCancel(context.Background())
+		defer cancel()
+		if err := CleanupPreCancel(ctx, func() error { return nil }); !errors.Is(err, ErrNoPreCancelBarrier) {
+			t.Errorf("got %v, want %v", err, ErrNoPreCancelBarrier)
+		}
+	})
+}
+
+func TestWithPerCleanupTimeout(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background(), WithPerCleanupTimeout(10*time.Millisecond))
+	var fast, overridden atomic.Bool
+	if err := CleanupWithContext(ctx, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Cleanup(ctx, func() error {
+		fast.Store(true)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := CleanupWithTimeout(ctx, time.Second, func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+			overridden.Store(true)
+			return nil
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	err := Wait(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if errors.Is(err, ErrWaitTimeout) {
+		t.Errorf("got %v, should not be %v", err, ErrWaitTimeout)
+	}
+	if !fast.Load() {
+		t.Error("the other cleanup function should be called")
+	}
+	if !overridden.Load() {
+		t.Error("the timeout of CleanupWithTimeout should override the default")
+	}
+}
+
+func TestWithMaxDepth(t *testing.T) {
+	var reported []string
+	orig := depthReport
+	depthReport = func(msg string) {
+		reported = append(reported, msg)
+	}
+	t.Cleanup(func() {
+		depthReport = orig
+	})
+
+	// A middleware applied repeatedly wraps the same context again and again
+	middleware := func(ctx context.Context) context.Context {
+		ctx, _ = WithCancel(ctx)
+		return ctx
+	}
+	ctx, cancel := WithCancel(context.Background(), WithMaxDepth(2))
+	defer cancel()
+	for range 4 {
+		ctx = middleware(ctx)
+	}
+	if len(reported) != 2 {
+		t.Fatalf("got %d reports, want %d", len(reported), 2)
+	}
+	if want := "donegroup: the doneGroup is nested 3 deep, exceeding the max depth of 2"; !strings.HasPrefix(reported[0], want) {
+		t.Errorf("got %q, want prefix %q", reported[0], want)
+	}
+	if err := Cleanup(ctx, func() error { return nil }); err != nil {
+		t.Error(err)
+	}
+
+	t.Run("WithStrictMaxDepth", func(t *testing.T) {
+		ctx, cancel := WithCancel(context.Background(), WithStrictMaxDepth(1))
+		defer cancel()
+		child := middleware(ctx)
+		if err := Cleanup(child, func() error { return nil }); err != nil {
+			t.Error(err)
+		}
+		grandchild := middleware(child)
+		called := false
+		if err := Cleanup(grandchild, func() error {
+			called = true
+			return nil
+		}); !errors.Is(err, ErrMaxDepthExceeded) {
+			t.Errorf("got %v, want %v", err, ErrMaxDepthExceeded)
+		}
+		cancel()
+		if err := Wait(ctx); err != nil {
+			t.Error(err)
+		}
+		if !called {
+			t.Error("the cleanup function should still be called")
+		}
+		if len(reported) != 2 {
+			t.Errorf("got %d reports, want %d", len(reported), 2)
+		}
+	})
+}
+
+func TestWithHeartbeat(t *testing.T) {
+	t.Parallel()
+	var beats atomic.Int64
+	ctx, cancel := WithCancel(context.Background(), WithHeartbeat(5*time.Millisecond, func() {
+		beats.Add(1)
+	}))
+	if err := Cleanup(ctx, func() error {
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := Wait(ctx); err != nil {
+		t.Error(err)
+	}
+	got := beats.Load()
+	if got == 0 {
+		t.Error("the heartbeat function should be called while waiting")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if after := beats.Load(); after != got {
+		t.Errorf("the heartbeat function should not be called after Wait returns: got %d, want %d", after, got)
+	}
+
+	t.Run("Timeout", func(t *testing.T) {
+		t.Parallel()
+		var beats atomic.Int64
+		ctx, cancel := WithCancel(context.Background(), WithHeartbeat(5*time.Millisecond, func() {
+			beats.Add(1)
+		}))
+		if err := Cleanup(ctx, func() error {
+			time.Sleep(100 * time.Millisecond)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		if err := WaitWithTimeout(ctx, 20*time.Millisecond); !errors.Is(err, ErrWaitTimeout) {
+			t.Errorf("got %v, want %v", err, ErrWaitTimeout)
+		}
+		got := beats.Load()
+		time.Sleep(20 * time.Millisecond)
+		if after := beats.Load(); after != got {
+			t.Errorf("the heartbeat function should not be called after the wait times out: got %d, want %d", after, got)
+		}
+	})
+}
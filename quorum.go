@@ -0,0 +1,69 @@
+package donegroup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// WaitQuorum blocks until the context is canceled. Then calls the function registered by Cleanup, and returns once n of them have succeeded (e.g. a flush to 2 of 3 replicas).
+// It returns nil when the quorum is reached, without waiting for the rest.
+// If the timeout has passed before that, it returns the errors collected so far joined with ErrWaitTimeout.
+// If all the cleanup functions (and processes) finish without reaching the quorum, it returns the errors joined with ErrQuorumNotReached.
+// The rest of the cleanup functions are abandoned but keep running in the background with their context not canceled, and their errors can be collected later by CollectedErrors.
+// The successes are counted for the cleanup functions of the doneGroup itself (not of the descendants).
+func WaitQuorum(ctx context.Context, n int, timeout time.Duration) error {
+	return WaitQuorumWithKey(ctx, doneGroupKey, n, timeout)
+}
+
+// WaitQuorumWithKey blocks until the context is canceled. Then calls the function registered by CleanupWithKey, and returns once n of them have succeeded (e.g. a flush to 2 of 3 replicas).
+// It returns nil when the quorum is reached, without waiting for the rest.
+// If the timeout has passed before that, it returns the errors collected so far joined with ErrWaitTimeout.
+// If all the cleanup functions (and processes) finish without reaching the quorum, it returns the errors joined with ErrQuorumNotReached.
+// The rest of the cleanup functions are abandoned but keep running in the background with their context not canceled, and their errors can be collected later by CollectedErrorsWithKey.
+// The successes are counted for the cleanup functions of the doneGroup itself (not of the descendants).
+func WaitQuorumWithKey(ctx context.Context, key any, n int, timeout time.Duration) error {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return ErrNotContainDoneGroup
+	}
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	ch := make(chan struct{}, 1)
+	dg.mu.Lock()
+	dg.quorumWatchers = append(dg.quorumWatchers, ch)
+	dg.mu.Unlock()
+	defer func() {
+		dg.mu.Lock()
+		defer dg.mu.Unlock()
+		dg.quorumWatchers = slices.DeleteFunc(dg.quorumWatchers, func(w chan struct{}) bool {
+			return w == ch
+		})
+	}()
+	<-ctx.Done()
+	settled := dg.settledChan()
+	for {
+		dg.mu.Lock()
+		succeeded := dg.succeeded
+		dg.mu.Unlock()
+		if succeeded >= n {
+			return nil
+		}
+		select {
+		case <-ch:
+		case <-settled:
+			// The last success may be notified at the same time
+			dg.mu.Lock()
+			succeeded = dg.succeeded
+			dg.mu.Unlock()
+			if succeeded >= n {
+				return nil
+			}
+			return errors.Join(fmt.Errorf("%w: %d of %d succeeded", ErrQuorumNotReached, succeeded, n), dg.aggregateErrors(joinErrors))
+		case <-t.C:
+			return errors.Join(fmt.Errorf("%w: %w", ErrWaitTimeout, context.DeadlineExceeded), dg.aggregateErrors(joinErrors))
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package donegroup
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWaitQuorum(t *testing.T) {
+	t.Parallel()
+	errReplica := errors.New("replica unreachable")
+	ctx, cancel := WithCancel(context.Background())
+	var slowFinished atomic.Bool
+	for _, d := range []time.Duration{0, 10 * time.Millisecond} {
+		if err := Cleanup(ctx, func() error {
+			time.Sleep(d)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Cleanup(ctx, func() error {
+		time.Sleep(200 * time.Millisecond)
+		slowFinished.Store(true)
+		return errReplica
+	}); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := WaitQuorum(ctx, 2, time.Second); err != nil {
+		t.Error(err)
+	}
+	if slowFinished.Load() {
+		t.Error("WaitQuorum should not wait for the rest")
+	}
+	// The abandoned cleanup function keeps running, and its error is collected later
+	<-Settled(ctx)
+	errs, err := CollectedErrors(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(errors.Join(errs...), errReplica) {
+		t.Errorf("got %v, want %v", errs, errReplica)
+	}
+
+	t.Run("Not reached", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := WithCancel(context.Background())
+		if err := Cleanup(ctx, func() error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+		if err := Cleanup(ctx, func() error { return errReplica }); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		err := WaitQuorum(ctx, 2, time.Second)
+		if !errors.Is(err, ErrQuorumNotReached) || !errors.Is(err, errReplica) {
+			t.Errorf("got %v, want %v and %v", err, ErrQuorumNotReached, errReplica)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := WithCancel(context.Background())
+		if err := Cleanup(ctx, func() error {
+			time.Sleep(100 * time.Millisecond)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		if err := WaitQuorum(ctx, 1, 10*time.Millisecond); !errors.Is(err, ErrWaitTimeout) {
+			t.Errorf("got %v, want %v", err, ErrWaitTimeout)
+		}
+	})
+}
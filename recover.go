@@ -0,0 +1,73 @@
+package donegroup
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is the cancellation cause set by Recover when a panic is recovered.
+type PanicError struct {
+	// Value is the value passed to panic.
+	Value any
+	// Stack is the stack trace at the time of the panic.
+	Stack []byte
+}
+
+// Error returns the panic value and the stack trace.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("donegroup: panic: %v\n\n%s", e.Value, e.Stack)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
+
+// WithRepanic makes Recover re-panic with the recovered value after the cleanup functions finish.
+// By default, Recover swallows the panic.
+func WithRepanic() Option {
+	return func(c *config) {
+		c.repanic = true
+	}
+}
+
+// Recover recovers from a panic and cancels the context with a cause of *PanicError. It must be called directly by defer.
+// By default, it swallows the panic and returns. If WithRepanic is set, it waits for the cleanup functions to finish and then re-panics with the recovered value.
+// In a process, pass the context received by GoWithContext (or GoN) so that the process is completed before waiting.
+// With the context of the doneGroup itself, Recover in a process started by Go (or an Awaiter) waits for that process and never returns.
+func Recover(ctx context.Context) {
+	if v := recover(); v != nil {
+		recoverWithKey(ctx, doneGroupKey, v)
+	}
+}
+
+// RecoverWithKey recovers from a panic and cancels the context with a cause of *PanicError. It must be called directly by defer.
+// By default, it swallows the panic and returns. If WithRepanic is set, it waits for the cleanup functions to finish and then re-panics with the recovered value.
+// In a process, pass the context received by GoWithContextAndKey (or GoNWithKey) so that the process is completed before waiting.
+// With the context of the doneGroup itself, RecoverWithKey in a process started by GoWithKey (or an Awaiter) waits for that process and never returns.
+func RecoverWithKey(ctx context.Context, key any) {
+	if v := recover(); v != nil {
+		recoverWithKey(ctx, key, v)
+	}
+}
+
+func recoverWithKey(ctx context.Context, key, v any) {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		panic(v)
+	}
+	_ = CancelWithCauseAndKey(ctx, &PanicError{Value: v, Stack: debug.Stack()}, key)
+	if !dg.config.repanic {
+		return
+	}
+	if completed, ok := ctx.Value(goTaskKey{}).(func()); ok {
+		// The process never finishes by itself because it re-panics, so complete it before waiting for it
+		completed()
+	}
+	_ = WaitWithKey(ctx, key)
+	panic(v)
+}
@@ -0,0 +1,121 @@
+package donegroup
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRecover(t *testing.T) {
+	t.Parallel()
+	errTest := errors.New("test error")
+
+	t.Run("Swallow the panic", func(t *testing.T) {
+		t.Parallel()
+		ctx, _ := WithCancel(context.Background())
+		cleanup := atomic.Bool{}
+		if err := Cleanup(ctx, func() error {
+			cleanup.Store(true)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		func() {
+			defer Recover(ctx)
+			panic(errTest)
+		}()
+		if err := Wait(ctx); err != nil {
+			t.Error(err)
+		}
+		if !cleanup.Load() {
+			t.Error("cleanup function not called")
+		}
+		var pe *PanicError
+		if !errors.As(context.Cause(ctx), &pe) {
+			t.Fatalf("got %v, want *PanicError", context.Cause(ctx))
+		}
+		if !errors.Is(pe, errTest) {
+			t.Errorf("got %v, want %v", pe, errTest)
+		}
+		if len(pe.Stack) == 0 {
+			t.Error("expected stack trace")
+		}
+	})
+
+	t.Run("Re-panic after cleanup", func(t *testing.T) {
+		t.Parallel()
+		ctx, _ := WithCancel(context.Background(), WithRepanic())
+		cleanup := atomic.Bool{}
+		if err := Cleanup(ctx, func() error {
+			cleanup.Store(true)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		var got any
+		func() {
+			defer func() {
+				got = recover()
+			}()
+			defer Recover(ctx)
+			panic("test panic")
+		}()
+		if got != "test panic" {
+			t.Errorf("got %v, want %v", got, "test panic")
+		}
+		if !cleanup.Load() {
+			t.Error("cleanup function not called before re-panic")
+		}
+	})
+
+	t.Run("No panic", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := WithCancel(context.Background())
+		defer cancel()
+		func() {
+			defer Recover(ctx)
+		}()
+		if ctx.Err() != nil {
+			t.Error("expected not canceled")
+		}
+	})
+
+	t.Run("Re-panic in a process", func(t *testing.T) {
+		t.Parallel()
+		ctx, _ := WithCancel(context.Background(), WithRepanic(), WithCancellerStack())
+		cleanup := atomic.Bool{}
+		if err := Cleanup(ctx, func() error {
+			cleanup.Store(true)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		got := make(chan any, 1)
+		GoWithContext(ctx, func(ctx context.Context) error {
+			defer func() {
+				got <- recover()
+			}()
+			defer Recover(ctx)
+			panic("test panic")
+		})
+		select {
+		case v := <-got:
+			if v != "test panic" {
+				t.Errorf("got %v, want %v", v, "test panic")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Recover should not wait for the process itself")
+		}
+		if !cleanup.Load() {
+			t.Error("cleanup function not called before re-panic")
+		}
+		if CancellerStack(ctx) == nil {
+			t.Error("the cancellation by Recover should be attributed")
+		}
+		if err := Wait(ctx); err != nil {
+			t.Error(err)
+		}
+	})
+}
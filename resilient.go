@@ -0,0 +1,113 @@
+package donegroup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+var ErrRetriesExhausted = errors.New("donegroup: cleanup function retries exhausted")
+var ErrCircuitBroken = errors.New("donegroup: cleanup function circuit broken by repeated panics")
+
+// ResilientOption is an option for CleanupResilient.
+type ResilientOption func(*resilientConfig)
+
+type resilientConfig struct {
+	maxAttempts      int
+	backoff          time.Duration
+	breakAfterPanics int
+}
+
+// MaxAttempts sets the maximum number of attempts of the cleanup function of CleanupResilient. The default is 3.
+func MaxAttempts(n int) ResilientOption {
+	return func(c *resilientConfig) {
+		c.maxAttempts = n
+	}
+}
+
+// Backoff sets the wait before the first retry of the cleanup function of CleanupResilient. It doubles on each retry. The default is 100ms.
+func Backoff(d time.Duration) ResilientOption {
+	return func(c *resilientConfig) {
+		c.backoff = d
+	}
+}
+
+// BreakAfterPanics sets the number of consecutive panics after which CleanupResilient gives up without using the remaining attempts. The default is 2.
+func BreakAfterPanics(n int) ResilientOption {
+	return func(c *resilientConfig) {
+		c.breakAfterPanics = n
+	}
+}
+
+// CleanupResilient registers a function to be called when the context is canceled. The function is retried with backoff if it returns an error or panics.
+// A panic is converted to *PanicError between the attempts. It is intended for the teardown of fragile clients that occasionally panic.
+// If all the attempts fail, the error wraps ErrRetriesExhausted and the last error. If the function panics consecutively BreakAfterPanics times, it gives up and the error wraps ErrCircuitBroken and the last *PanicError.
+// If the context passed to the cleanup functions is canceled (e.g. by the timeout of WaitWithTimeout), it stops retrying and the error wraps ErrRetriesExhausted.
+func CleanupResilient(ctx context.Context, f func() error, opts ...ResilientOption) error {
+	return CleanupResilientWithKey(ctx, doneGroupKey, f, opts...)
+}
+
+// CleanupResilientWithKey registers a function to be called when the context is canceled. The function is retried with backoff if it returns an error or panics.
+// A panic is converted to *PanicError between the attempts. It is intended for the teardown of fragile clients that occasionally panic.
+// If all the attempts fail, the error wraps ErrRetriesExhausted and the last error. If the function panics consecutively BreakAfterPanics times, it gives up and the error wraps ErrCircuitBroken and the last *PanicError.
+// If the context passed to the cleanup functions is canceled (e.g. by the timeout of WaitWithTimeout), it stops retrying and the error wraps ErrRetriesExhausted.
+func CleanupResilientWithKey(ctx context.Context, key any, f func() error, opts ...ResilientOption) error {
+	if f == nil {
+		return ErrNilFunc
+	}
+	cfg := &resilientConfig{
+		maxAttempts:      3,
+		backoff:          100 * time.Millisecond,
+		breakAfterPanics: 2,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return CleanupWithContextAndKey(ctx, key, func(ctx context.Context) error {
+		return retry(ctx, f, cfg)
+	})
+}
+
+// retry calls f until it succeeds, the attempts are exhausted, the circuit is broken, or the context is canceled.
+func retry(ctx context.Context, f func() error, cfg *resilientConfig) error {
+	backoff := cfg.backoff
+	panics := 0
+	for attempt := 1; ; attempt++ {
+		err, panicked := callRecover(f)
+		if err == nil {
+			return nil
+		}
+		if panicked {
+			panics++
+		} else {
+			panics = 0
+		}
+		if cfg.breakAfterPanics > 0 && panics >= cfg.breakAfterPanics {
+			return fmt.Errorf("%w after %d consecutive panics: %w", ErrCircuitBroken, panics, err)
+		}
+		if attempt >= cfg.maxAttempts {
+			return fmt.Errorf("%w after %d attempts: %w", ErrRetriesExhausted, attempt, err)
+		}
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return fmt.Errorf("%w after %d attempts: %w", ErrRetriesExhausted, attempt, errors.Join(err, context.Cause(ctx)))
+		case <-t.C:
+		}
+		backoff *= 2
+	}
+}
+
+// callRecover calls f and converts a panic to *PanicError.
+func callRecover(f func() error) (err error, panicked bool) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &PanicError{Value: v, Stack: debug.Stack()}
+			panicked = true
+		}
+	}()
+	return f(), false
+}
@@ -0,0 +1,107 @@
+package donegroup
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCleanupResilient(t *testing.T) {
+	t.Parallel()
+	errTest := errors.New("test error")
+	tests := []struct {
+		name      string
+		f         func(attempt int64) error
+		opts      []ResilientOption
+		wantCalls int64
+		wantErr   error
+	}{
+		{
+			name: "succeed after a panic",
+			f: func(attempt int64) error {
+				if attempt == 1 {
+					panic("fragile")
+				}
+				return nil
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "exhausted retries",
+			f: func(int64) error {
+				return errTest
+			},
+			opts:      []ResilientOption{MaxAttempts(4)},
+			wantCalls: 4,
+			wantErr:   ErrRetriesExhausted,
+		},
+		{
+			name: "circuit broken",
+			f: func(int64) error {
+				panic(errTest)
+			},
+			opts:      []ResilientOption{MaxAttempts(10), BreakAfterPanics(3)},
+			wantCalls: 3,
+			wantErr:   ErrCircuitBroken,
+		},
+		{
+			name: "errors reset the consecutive panics",
+			f: func(attempt int64) error {
+				if attempt%2 == 0 {
+					return errTest
+				}
+				panic("fragile")
+			},
+			opts:      []ResilientOption{MaxAttempts(5)},
+			wantCalls: 5,
+			wantErr:   ErrRetriesExhausted,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := WithCancel(context.Background())
+			var calls atomic.Int64
+			opts := append([]ResilientOption{Backoff(time.Millisecond)}, tt.opts...)
+			if err := CleanupResilient(ctx, func() error {
+				return tt.f(calls.Add(1))
+			}, opts...); err != nil {
+				t.Fatal(err)
+			}
+			cancel()
+			err := Wait(ctx)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("got %v, want nil", err)
+				}
+			} else if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("got %d calls, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+
+	t.Run("stop retrying on the wait timeout", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := WithCancel(context.Background())
+		if err := CleanupResilient(ctx, func() error {
+			return errTest
+		}, Backoff(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		_ = WaitWithTimeout(ctx, 10*time.Millisecond)
+		<-Settled(ctx)
+		errs, err := CollectedErrors(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := errors.Join(errs...); !errors.Is(err, ErrRetriesExhausted) || !errors.Is(err, errTest) {
+			t.Errorf("got %v, want %v and %v", err, ErrRetriesExhausted, errTest)
+		}
+	})
+}
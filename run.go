@@ -0,0 +1,97 @@
+package donegroup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ErrSignalReceived is the cause of the cancellation by WaitForSignal.
+var ErrSignalReceived = errors.New("donegroup: signal received")
+
+// Run is an all-in-one runner for the shutdown of a program.
+// It creates a context with a doneGroup that is canceled when os.Interrupt or syscall.SIGTERM is received, and calls setup with the context.
+// setup is expected to register the cleanup functions and start the processes (e.g. by Go), and to return without blocking.
+// Then Run blocks until the context is canceled, and waits for the cleanup functions and processes with Wait.
+// The timeout of waiting can be set by WithWaitTimeout.
+// If setup returns an error, Run cancels the context, waits, and returns the error joined with the errors of Wait.
+// After the context is canceled, the signals are restored to the default behavior, so a second signal terminates the program.
+func Run(setup func(ctx context.Context) error, opts ...Option) error {
+	sctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := WithCancel(sctx, opts...)
+	defer cancel()
+	if err := setup(ctx); err != nil {
+		cancel()
+		stop()
+		return errors.Join(err, Wait(ctx))
+	}
+	<-ctx.Done()
+	stop()
+	return Wait(ctx)
+}
+
+// WaitForSignal blocks until one of the signals arrives (os.Interrupt and syscall.SIGTERM if no signals are given), or the context is canceled.
+// Then it cancels the context with the cause wrapping ErrSignalReceived, and waits for the cleanup functions like Wait.
+// A second signal aborts the waiting like the timeout of WaitWithTimeout.
+func WaitForSignal(ctx context.Context, signals ...os.Signal) error {
+	return WaitForSignalWithTimeoutAndKey(ctx, 0, doneGroupKey, signals...)
+}
+
+// WaitForSignalWithTimeout blocks until one of the signals arrives (os.Interrupt and syscall.SIGTERM if no signals are given), or the context is canceled.
+// Then it cancels the context with the cause wrapping ErrSignalReceived, and waits for the cleanup functions with timeout like WaitWithTimeout.
+// A second signal aborts the waiting like the timeout.
+func WaitForSignalWithTimeout(ctx context.Context, timeout time.Duration, signals ...os.Signal) error {
+	return WaitForSignalWithTimeoutAndKey(ctx, timeout, doneGroupKey, signals...)
+}
+
+// WaitForSignalWithKey blocks until one of the signals arrives (os.Interrupt and syscall.SIGTERM if no signals are given), or the context is canceled.
+// Then it cancels the context with the cause wrapping ErrSignalReceived, and waits for the cleanup functions like WaitWithKey.
+// A second signal aborts the waiting like the timeout of WaitWithTimeoutAndKey.
+func WaitForSignalWithKey(ctx context.Context, key any, signals ...os.Signal) error {
+	return WaitForSignalWithTimeoutAndKey(ctx, 0, key, signals...)
+}
+
+// WaitForSignalWithTimeoutAndKey blocks until one of the signals arrives (os.Interrupt and syscall.SIGTERM if no signals are given), or the context is canceled.
+// Then it cancels the context with the cause wrapping ErrSignalReceived, and waits for the cleanup functions with timeout like WaitWithTimeoutAndKey.
+// If timeout is less than or equal to 0, the default wait timeout set by WithWaitTimeout is used.
+// A second signal aborts the waiting like the timeout.
+func WaitForSignalWithTimeoutAndKey(ctx context.Context, timeout time.Duration, key any, signals ...os.Signal) error {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return ErrNotContainDoneGroup
+	}
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, signals...)
+	defer signal.Stop(sig)
+	select {
+	case s := <-sig:
+		_ = CancelWithCauseAndKey(ctx, fmt.Errorf("%w: %v", ErrSignalReceived, s), key)
+	case <-ctx.Done():
+	}
+	if timeout <= 0 {
+		timeout = dg.config.waitTimeout
+	}
+	ctxw, abort := context.WithCancel(context.WithoutCancel(ctx))
+	defer abort()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctxw, cancel = context.WithTimeout(ctxw, timeout)
+		defer cancel()
+	}
+	go func() {
+		select {
+		case <-sig:
+			abort()
+		case <-ctxw.Done():
+		}
+	}()
+	return WaitWithContextAndKey(ctx, ctxw, key)
+}
@@ -0,0 +1,163 @@
+package donegroup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	errSetup := errors.New("setup error")
+	errCleanup := errors.New("cleanup error")
+	tests := []struct {
+		name  string
+		setup func(ctx context.Context) error
+		want  []error
+	}{
+		{
+			"signal",
+			func(ctx context.Context) error {
+				if err := Cleanup(ctx, func() error { return errCleanup }); err != nil {
+					return err
+				}
+				return syscall.Kill(os.Getpid(), syscall.SIGTERM)
+			},
+			[]error{errCleanup},
+		},
+		{
+			"setup error",
+			func(ctx context.Context) error {
+				if err := Cleanup(ctx, func() error { return errCleanup }); err != nil {
+					return err
+				}
+				return errSetup
+			},
+			[]error{errSetup, errCleanup},
+		},
+		{
+			"canceled",
+			func(ctx context.Context) error {
+				Go(ctx, func() error {
+					return Cancel(ctx)
+				})
+				return nil
+			},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Run(tt.setup)
+			if tt.want == nil && err != nil {
+				t.Errorf("got %v, want nil", err)
+			}
+			for _, want := range tt.want {
+				if !errors.Is(err, want) {
+					t.Errorf("got %v, want %v", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRunWithWaitTimeout(t *testing.T) {
+	finished := atomic.Bool{}
+	err := Run(func(ctx context.Context) error {
+		if err := Cleanup(ctx, func() error {
+			time.Sleep(time.Second)
+			finished.Store(true)
+			return nil
+		}); err != nil {
+			return err
+		}
+		return syscall.Kill(os.Getpid(), syscall.SIGINT)
+	}, WithWaitTimeout(10*time.Millisecond))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if finished.Load() {
+		t.Error("Run should not wait for the slow cleanup function")
+	}
+}
+
+func TestWaitForSignal(t *testing.T) {
+	// Catch the signals also in the test not to terminate the process before WaitForSignal starts catching
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGUSR1)
+	defer signal.Stop(sig)
+	kill := func(ctx context.Context) {
+		for {
+			if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+				t.Error(err)
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}
+
+	t.Run("signal", func(t *testing.T) {
+		ctx, cancel := WithCancel(context.Background())
+		defer cancel()
+		called := atomic.Bool{}
+		if err := Cleanup(ctx, func() error {
+			called.Store(true)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		go kill(ctx)
+		if err := WaitForSignal(ctx, syscall.SIGUSR1); err != nil {
+			t.Error(err)
+		}
+		if !called.Load() {
+			t.Error("cleanup function not called")
+		}
+		if !errors.Is(context.Cause(ctx), ErrSignalReceived) {
+			t.Errorf("got %v, want %v", context.Cause(ctx), ErrSignalReceived)
+		}
+	})
+
+	t.Run("second signal aborts waiting", func(t *testing.T) {
+		ctx, cancel := WithCancel(context.Background())
+		defer cancel()
+		release := make(chan struct{})
+		defer close(release)
+		if err := Cleanup(ctx, func() error {
+			<-release
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		killCtx, stop := context.WithCancel(context.Background())
+		defer stop()
+		go kill(killCtx)
+		if err := WaitForSignal(ctx, syscall.SIGUSR1); !errors.Is(err, ErrWaitTimeout) {
+			t.Errorf("got %v, want %v", err, ErrWaitTimeout)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		ctx, cancel := WithCancel(context.Background())
+		release := make(chan struct{})
+		defer close(release)
+		if err := Cleanup(ctx, func() error {
+			<-release
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		if err := WaitForSignalWithTimeout(ctx, 10*time.Millisecond, syscall.SIGUSR1); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package donegroup
+
+import "fmt"
+
+// Level is the severity of the error of the cleanup function.
+type Level int
+
+const (
+	// LevelNone is the severity of no error.
+	LevelNone Level = iota
+	// LevelWarn is the severity of the error that does not affect the result of the shutdown (e.g. a failed metrics flush).
+	LevelWarn
+	// LevelError is the severity of the error without severity.
+	LevelError
+	// LevelCritical is the severity of the error that must be alerted (e.g. a failed transaction rollback).
+	LevelCritical
+)
+
+// String returns the name of the severity.
+func (l Level) String() string {
+	switch l {
+	case LevelNone:
+		return "none"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	case LevelCritical:
+		return "critical"
+	default:
+		return fmt.Sprintf("Level(%d)", int(l))
+	}
+}
+
+// SeverityError is the error with severity returned by Warn and Critical.
+// The cleanup functions can also return their own error implementing the Severity method.
+type SeverityError struct {
+	// Level is the severity of the error.
+	Level Level
+	// Err is the error.
+	Err error
+}
+
+// Error returns the error.
+func (e *SeverityError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error.
+func (e *SeverityError) Unwrap() error {
+	return e.Err
+}
+
+// Severity returns the severity of the error.
+func (e *SeverityError) Severity() Level {
+	return e.Level
+}
+
+// Warn returns the error with the severity of LevelWarn. It returns nil if err is nil.
+func Warn(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &SeverityError{Level: LevelWarn, Err: err}
+}
+
+// Critical returns the error with the severity of LevelCritical. It returns nil if err is nil.
+func Critical(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &SeverityError{Level: LevelCritical, Err: err}
+}
+
+// MaxSeverity returns the maximum severity of the errors returned by Wait (e.g. to decide the exit code and alerting by the worst failure).
+// The severity is the one of the outermost error implementing the Severity method in each branch of the error tree, and the error without severity is LevelError.
+// It returns LevelNone if err is nil.
+// The errors aggregated by WaitWithAggregator keep their severity only if the aggregator wraps them (e.g. by errors.Join or fmt.Errorf with %w).
+// Otherwise (e.g. flattening them into a message) the aggregated error is LevelError.
+func MaxSeverity(err error) Level {
+	if err == nil {
+		return LevelNone
+	}
+	switch u := err.(type) {
+	case interface{ Severity() Level }:
+		return u.Severity()
+	case interface{ Unwrap() []error }:
+		level := LevelNone
+		for _, err := range u.Unwrap() {
+			level = max(level, MaxSeverity(err))
+		}
+		return level
+	case interface{ Unwrap() error }:
+		if err := u.Unwrap(); err != nil {
+			return MaxSeverity(err)
+		}
+	}
+	return LevelError
+}
@@ -0,0 +1,60 @@
+package donegroup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestMaxSeverity(t *testing.T) {
+	t.Parallel()
+	errTest := errors.New("test error")
+	tests := []struct {
+		name string
+		err  error
+		want Level
+	}{
+		{"nil", nil, LevelNone},
+		{"without severity", errTest, LevelError},
+		{"warn", Warn(errTest), LevelWarn},
+		{"critical", Critical(errTest), LevelCritical},
+		{"wrapped", fmt.Errorf("flush: %w", Warn(errTest)), LevelWarn},
+		{"outermost wins", Critical(Warn(errTest)), LevelCritical},
+		{"joined", errors.Join(Warn(errTest), Critical(errTest)), LevelCritical},
+		{"joined with error without severity", errors.Join(Warn(errTest), errTest), LevelError},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := MaxSeverity(tt.err); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if Warn(nil) != nil || Critical(nil) != nil {
+		t.Error("should return nil for nil")
+	}
+}
+
+func TestMaxSeverityWait(t *testing.T) {
+	t.Parallel()
+	errFlush := errors.New("flush failed")
+	errRollback := errors.New("rollback failed")
+	ctx, cancel := WithCancel(context.Background())
+	if err := Cleanup(ctx, func() error { return Warn(errFlush) }); err != nil {
+		t.Fatal(err)
+	}
+	if err := Cleanup(ctx, func() error { return Critical(errRollback) }); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	err := Wait(ctx)
+	if !errors.Is(err, errFlush) || !errors.Is(err, errRollback) {
+		t.Errorf("got %v, want %v and %v", err, errFlush, errRollback)
+	}
+	if got := MaxSeverity(err); got != LevelCritical {
+		t.Errorf("got %v, want %v", got, LevelCritical)
+	}
+}
@@ -0,0 +1,37 @@
+package donegroup
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const maxStackFrames = 8
+
+var packageDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Dir(file)
+}()
+
+// callerStack returns a short stack trace of the caller of the donegroup package.
+func callerStack() string {
+	pc := make([]uintptr, 32)
+	n := runtime.Callers(2, pc)
+	frames := runtime.CallersFrames(pc[:n])
+	var (
+		b     strings.Builder
+		count int
+	)
+	for {
+		frame, more := frames.Next()
+		if filepath.Dir(frame.File) != packageDir || strings.HasSuffix(frame.File, "_test.go") {
+			_, _ = fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+			count++
+		}
+		if !more || count >= maxStackFrames {
+			break
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,61 @@
+package donegroup
+
+import (
+	"context"
+	"sync"
+)
+
+// ShutdownStore is a concurrent-safe store for the cleanup functions to share data during shutdown (e.g. a tally of bytes flushed).
+// It is scoped to a Wait: the store is discarded when Wait of the doneGroup returns.
+// A nil *ShutdownStore is valid and stores nothing.
+type ShutdownStore struct {
+	m sync.Map
+}
+
+// Store returns the ShutdownStore of the doneGroup. The store is allocated on the first call.
+// It returns nil if the context does not contain a doneGroup.
+func Store(ctx context.Context) *ShutdownStore {
+	return StoreWithKey(ctx, doneGroupKey)
+}
+
+// StoreWithKey returns the ShutdownStore of the doneGroup. The store is allocated on the first call.
+// It returns nil if the context does not contain a doneGroup.
+func StoreWithKey(ctx context.Context, key any) *ShutdownStore {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return nil
+	}
+	dg.mu.Lock()
+	defer dg.mu.Unlock()
+	if dg.store == nil {
+		dg.store = &ShutdownStore{}
+	}
+	return dg.store
+}
+
+// Set sets the value for the key.
+func (s *ShutdownStore) Set(k, v any) {
+	if s == nil {
+		return
+	}
+	s.m.Store(k, v)
+}
+
+// Get returns the value for the key. The ok result reports whether the value was found.
+func (s *ShutdownStore) Get(k any) (v any, ok bool) {
+	if s == nil {
+		return nil, false
+	}
+	return s.m.Load(k)
+}
+
+// discardStores discards the ShutdownStores of the doneGroup and its descendants.
+func (dg *doneGroup) discardStores() {
+	dg.mu.Lock()
+	dg.store = nil
+	children := dg.children
+	dg.mu.Unlock()
+	for _, c := range children {
+		c.discardStores()
+	}
+}
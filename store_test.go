@@ -0,0 +1,49 @@
+package donegroup
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background())
+	var mu sync.Mutex
+	for i := 1; i <= 3; i++ {
+		if err := CleanupWithContext(ctx, func(ctx context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			s := Store(ctx)
+			total, _ := s.Get("bytes")
+			n, _ := total.(int)
+			s.Set("bytes", n+i*100)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := Store(ctx)
+	cancel()
+	if err := Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := s.Get("bytes")
+	if got != 600 {
+		t.Errorf("got %v, want %v", got, 600)
+	}
+
+	// The store is discarded after Wait returns
+	if _, ok := Store(ctx).Get("bytes"); ok {
+		t.Error("store should be discarded after Wait")
+	}
+
+	var nilStore *ShutdownStore
+	nilStore.Set("k", "v")
+	if _, ok := nilStore.Get("k"); ok {
+		t.Error("nil store should store nothing")
+	}
+	if Store(context.Background()) != nil {
+		t.Error("got store for the context without doneGroup")
+	}
+}
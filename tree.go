@@ -0,0 +1,79 @@
+package donegroup
+
+import (
+	"context"
+	"time"
+)
+
+// TreeResult is the result of waiting for the doneGroup, mirroring the hierarchy of the doneGroups.
+type TreeResult struct {
+	// Context is the context of the doneGroup.
+	Context context.Context
+	// Depth is the depth of the doneGroup in the hierarchy. The root doneGroup is 0.
+	Depth int
+	// Errors is the errors of the cleanup functions (and processes) registered with the doneGroup itself, not including the descendants.
+	Errors error
+	// CanceledAt is the time when the doneGroup observed the cancellation of its context and started draining.
+	// A doneGroup canceled by the cascade observes it after its ancestors, so the times are ordered from the root to the leaves.
+	CanceledAt time.Time
+	// DrainedAt is the time when the cleanup functions registered with the doneGroup itself finished (CanceledAt if there are none).
+	// It is zero if some of them are still running (e.g. waiting timed out).
+	DrainedAt time.Time
+	// PropagationLatency is the time from the cancellation observed by the root of the result (the doneGroup waited for) to the cancellation observed by the doneGroup.
+	// It is zero for the doneGroup canceled before the root (e.g. by its own cancel func).
+	PropagationLatency time.Duration
+	// DrainDuration is the time from CanceledAt to DrainedAt. It is zero if DrainedAt is zero.
+	DrainDuration time.Duration
+	// Children is the results of the child doneGroups in the order of creation.
+	Children []*TreeResult
+}
+
+// WaitTreeResult blocks until the context is canceled. Then calls the function registered by Cleanup like Wait.
+// It returns the result mirroring the hierarchy of the doneGroups, each node carrying its own errors, with the aggregated error returned by Wait.
+// Each node also carries the timing of the cancellation cascade (the propagation latency from the root and the drain duration) to diagnose slow fan-out in deep hierarchies.
+func WaitTreeResult(ctx context.Context) (*TreeResult, error) {
+	return WaitTreeResultWithKey(ctx, doneGroupKey)
+}
+
+// WaitTreeResultWithKey blocks until the context is canceled. Then calls the function registered by Cleanup like WaitWithKey.
+// It returns the result mirroring the hierarchy of the doneGroups, each node carrying its own errors, with the aggregated error returned by WaitWithKey.
+// Each node also carries the timing of the cancellation cascade (the propagation latency from the root and the drain duration) to diagnose slow fan-out in deep hierarchies.
+func WaitTreeResultWithKey(ctx context.Context, key any) (*TreeResult, error) {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return nil, ErrNotContainDoneGroup
+	}
+	err := WaitWithKey(ctx, key)
+	dg.mu.Lock()
+	root := dg.canceledAt
+	dg.mu.Unlock()
+	return dg.treeResult(root), err
+}
+
+// treeResult returns the snapshot of the errors and the timing of the doneGroup and its descendants.
+// root is the time when the root of the result observed the cancellation.
+func (dg *doneGroup) treeResult(root time.Time) *TreeResult {
+	dg.mu.Lock()
+	r := &TreeResult{
+		Context:    dg.ctx,
+		Depth:      dg.depth,
+		Errors:     dg.ownErrors,
+		CanceledAt: dg.canceledAt,
+	}
+	if !r.CanceledAt.IsZero() && dg.pending == 0 {
+		r.DrainedAt = r.CanceledAt
+		if dg.finishedAt.After(r.DrainedAt) {
+			r.DrainedAt = dg.finishedAt
+		}
+		r.DrainDuration = r.DrainedAt.Sub(r.CanceledAt)
+	}
+	if !r.CanceledAt.IsZero() && !root.IsZero() {
+		r.PropagationLatency = max(r.CanceledAt.Sub(root), 0)
+	}
+	children := dg.children
+	dg.mu.Unlock()
+	for _, c := range children {
+		r.Children = append(r.Children, c.treeResult(root))
+	}
+	return r
+}
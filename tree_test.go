@@ -0,0 +1,79 @@
+package donegroup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWaitTreeResult(t *testing.T) {
+	t.Parallel()
+	errRoot := errors.New("root error")
+	errLeaf := errors.New("leaf error")
+	rootCtx, rootCancel := WithCancel(context.Background())
+	okCtx, _ := WithCancel(rootCtx)
+	leafCtx, _ := WithCancel(rootCtx)
+	if err := Cleanup(rootCtx, func() error { return errRoot }); err != nil {
+		t.Fatal(err)
+	}
+	if err := Cleanup(okCtx, func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := Cleanup(leafCtx, func() error { return errLeaf }); err != nil {
+		t.Fatal(err)
+	}
+	rootCancel()
+	r, err := WaitTreeResult(rootCtx)
+	if !errors.Is(err, errRoot) || !errors.Is(err, errLeaf) {
+		t.Errorf("got %v, want %v and %v", err, errRoot, errLeaf)
+	}
+	if !errors.Is(r.Errors, errRoot) || errors.Is(r.Errors, errLeaf) {
+		t.Errorf("got %v, want only %v", r.Errors, errRoot)
+	}
+	if len(r.Children) != 2 {
+		t.Fatalf("got %d children, want 2", len(r.Children))
+	}
+	if r.Children[0].Context != okCtx || r.Children[0].Errors != nil {
+		t.Errorf("got %+v, want the result of okCtx without errors", r.Children[0])
+	}
+	if r.Children[1].Context != leafCtx || r.Children[1].Depth != 1 || !errors.Is(r.Children[1].Errors, errLeaf) {
+		t.Errorf("got %+v, want the result of leafCtx with %v", r.Children[1], errLeaf)
+	}
+
+	if _, err := WaitTreeResult(context.Background()); !errors.Is(err, ErrNotContainDoneGroup) {
+		t.Errorf("got %v, want %v", err, ErrNotContainDoneGroup)
+	}
+}
+
+func TestWaitTreeResultTiming(t *testing.T) {
+	t.Parallel()
+	rootCtx, rootCancel := WithCancel(context.Background())
+	childCtx, _ := WithCancel(rootCtx)
+	leafCtx, _ := WithCancel(childCtx)
+	if err := Cleanup(leafCtx, func() error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	rootCancel()
+	r, err := WaitTreeResult(rootCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.CanceledAt.IsZero() || r.PropagationLatency != 0 || r.DrainDuration != 0 {
+		t.Errorf("got %+v, want the root canceled without cleanup functions", r)
+	}
+	child := r.Children[0]
+	leaf := child.Children[0]
+	if child.CanceledAt.Before(r.CanceledAt) || leaf.CanceledAt.Before(child.CanceledAt) {
+		t.Errorf("got %v, %v, %v, want the cancellation observed from the root to the leaf", r.CanceledAt, child.CanceledAt, leaf.CanceledAt)
+	}
+	if leaf.PropagationLatency != leaf.CanceledAt.Sub(r.CanceledAt) || leaf.PropagationLatency < child.PropagationLatency {
+		t.Errorf("got %v (child %v), want the propagation latency of the leaf from the root", leaf.PropagationLatency, child.PropagationLatency)
+	}
+	if leaf.DrainDuration < 20*time.Millisecond || !leaf.DrainedAt.Equal(leaf.CanceledAt.Add(leaf.DrainDuration)) {
+		t.Errorf("got %+v, want the drain duration of the leaf at least %v", leaf, 20*time.Millisecond)
+	}
+}
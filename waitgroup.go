@@ -0,0 +1,68 @@
+package donegroup
+
+import (
+	"context"
+	"sync"
+)
+
+// AddTask adds a manual task to the wait accounting of the doneGroup, and returns a function to call when the task completes.
+// Wait blocks until done is called, in addition to the cleanup functions. Calling done more than once is a no-op.
+// It is the low-level primitive of Awaiter and Go of TaskGroup: unlike Cleanup, nothing is called on cancellation,
+// and the task is accounted for from the moment of the call regardless of whether the context is canceled.
+// Note that if the timeout of WaitWithTimeout has passed (or the context of WaitWithContext has canceled), it will not wait.
+func AddTask(ctx context.Context) (done func(), err error) {
+	return AddTaskWithKey(ctx, doneGroupKey)
+}
+
+// AddTaskWithKey adds a manual task to the wait accounting of the doneGroup, and returns a function to call when the task completes.
+// WaitWithKey blocks until done is called, in addition to the cleanup functions. Calling done more than once is a no-op.
+// It is the low-level primitive of AwaiterWithKey and Go of TaskGroup: unlike CleanupWithKey, nothing is called on cancellation,
+// and the task is accounted for from the moment of the call regardless of whether the context is canceled.
+// Note that if the timeout of WaitWithTimeout has passed (or the context of WaitWithContext has canceled), it will not wait.
+func AddTaskWithKey(ctx context.Context, key any) (done func(), err error) {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return nil, ErrNotContainDoneGroup
+	}
+	return dg.addTask(), nil
+}
+
+// TaskGroup is a thin handle like sync.WaitGroup tied to a doneGroup.
+// The goroutines started by its Go are also waited for by Wait of the doneGroup.
+// To collect the errors of the goroutines, use Go of the package instead.
+type TaskGroup struct {
+	dg *doneGroup
+	wg sync.WaitGroup
+}
+
+// WaitGroup returns a TaskGroup tied to the doneGroup of the context.
+func WaitGroup(ctx context.Context) (*TaskGroup, error) {
+	return WaitGroupWithKey(ctx, doneGroupKey)
+}
+
+// WaitGroupWithKey returns a TaskGroup tied to the doneGroup of the context.
+func WaitGroupWithKey(ctx context.Context, key any) (*TaskGroup, error) {
+	dg, ok := ctx.Value(key).(*doneGroup)
+	if !ok {
+		return nil, ErrNotContainDoneGroup
+	}
+	return &TaskGroup{dg: dg}, nil
+}
+
+// Go calls f in a new goroutine like sync.WaitGroup.Go (Go 1.25).
+// The goroutine is waited for by both Wait of the TaskGroup and Wait of the doneGroup.
+func (g *TaskGroup) Go(f func()) {
+	completed := g.dg.addTask()
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer completed()
+		f()
+	}()
+}
+
+// Wait blocks until all the goroutines started by Go of the TaskGroup finish.
+// Unlike Wait of the package, it does not wait for the context to be canceled.
+func (g *TaskGroup) Wait() {
+	g.wg.Wait()
+}
@@ -0,0 +1,72 @@
+package donegroup
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWaitGroup(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background())
+	wg, err := WaitGroup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var finished atomic.Int64
+	wg.Go(func() {
+		finished.Add(1)
+	})
+	wg.Wait()
+	if got := finished.Load(); got != 1 {
+		t.Errorf("got %d, want 1", got)
+	}
+
+	wg.Go(func() {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		finished.Add(1)
+	})
+	cancel()
+	// Wait of the doneGroup also waits for the goroutines of the TaskGroup
+	if err := Wait(ctx); err != nil {
+		t.Error(err)
+	}
+	if got := finished.Load(); got != 2 {
+		t.Errorf("got %d, want 2", got)
+	}
+
+	if _, err := WaitGroup(context.Background()); !errors.Is(err, ErrNotContainDoneGroup) {
+		t.Errorf("got %v, want %v", err, ErrNotContainDoneGroup)
+	}
+}
+
+func TestAddTask(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := WithCancel(context.Background())
+	done, err := AddTask(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var finished atomic.Bool
+	go func() {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		finished.Store(true)
+		done()
+		done()
+	}()
+	cancel()
+	if err := Wait(ctx); err != nil {
+		t.Error(err)
+	}
+	if !finished.Load() {
+		t.Error("Wait should block until done is called")
+	}
+
+	if _, err := AddTask(context.Background()); !errors.Is(err, ErrNotContainDoneGroup) {
+		t.Errorf("got %v, want %v", err, ErrNotContainDoneGroup)
+	}
+}